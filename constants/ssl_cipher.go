@@ -0,0 +1,14 @@
+package constants
+
+// A map of SSL v2 cipher specs, along with their 3 byte IDs
+//
+// See https://datatracker.ietf.org/doc/html/draft-hickman-netscape-ssl-00
+var SSLv2CipherSpecs = map[string]uint32{
+	"SSL_CK_RC4_128_WITH_MD5":              0x010080,
+	"SSL_CK_RC4_128_EXPORT40_WITH_MD5":     0x020080,
+	"SSL_CK_RC2_128_CBC_WITH_MD5":          0x030080,
+	"SSL_CK_RC2_128_CBC_EXPORT40_WITH_MD5": 0x040080,
+	"SSL_CK_IDEA_128_CBC_WITH_MD5":         0x050080,
+	"SSL_CK_DES_64_CBC_WITH_MD5":           0x060040,
+	"SSL_CK_DES_192_EDE3_CBC_WITH_MD5":     0x0700c0,
+}
@@ -0,0 +1,8 @@
+package constants
+
+// A map of SSL versions, along with their IDs. SSL versions are deprecated in
+// the tls package, and are only detected with raw handshake probes.
+var SSLVersions = map[string]uint16{
+	"SSL v2": 0x0002,
+	"SSL v3": 0x0300,
+}
@@ -0,0 +1,271 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// PKCS#7 signed data content type, used for certs-only bundles (.p7c)
+var oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// Maximum number of intermediates fetched to complete a chain, which stops
+// fetching if the issuing certificate URLs form a loop
+const maxAIAFetches = 5
+
+// Timeout for downloading a certificate from an issuing certificate URL
+const aiaFetchTimeout = 10 * time.Second
+
+// Largest response read from an issuing certificate URL
+const maxAIAResponseSize = 1024 * 1024
+
+// An intermediate certificate downloaded to complete the chain
+type aiaCertificate struct {
+	URL               string `json:"url"`
+	Subject           string `json:"subject"`
+	Issuer            string `json:"issuer"`
+	SerialNumber      string `json:"serial_number"`
+	FingerprintSHA256 string `json:"fingerprint_sha256"`
+	PEM               string `json:"pem"`
+}
+
+// A presented certificate which is not part of the chain from the leaf
+type extraCertificate struct {
+	Position int    `json:"position"`
+	Subject  string `json:"subject"`
+	Issuer   string `json:"issuer"`
+}
+
+type chainCompleteness struct {
+	ChainComplete        bool
+	ChainOutOfOrder      bool
+	ExtraCertificates    []extraCertificate
+	FetchedIntermediates []aiaCertificate
+	AIAChainComplete     bool
+}
+
+// Check if the presented certificates, starting with the leaf certificate,
+// link the leaf to a trusted root or a self-signed certificate. If they don't,
+// the missing intermediates are fetched from the issuing certificate URLs
+// (authority information access), as browsers do.
+func checkChainCompleteness(ctx context.Context, d *plugin.QueryData, client *http.Client, chain []*x509.Certificate, roots *x509.CertPool) chainCompleteness {
+	result := chainCompleteness{}
+
+	// Follow the issuers through the presented certificates
+	path := []int{0}
+	used := map[int]bool{0: true}
+	for {
+		current := chain[path[len(path)-1]]
+		if isCertificateIssuedBy(current, current) {
+			break
+		}
+		next := -1
+		for position, c := range chain {
+			if !used[position] && isCertificateIssuedBy(current, c) {
+				next = position
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		path = append(path, next)
+		used[next] = true
+	}
+
+	// The certificates should be sent in order, each one followed by its
+	// issuer. Any certificate not in the path is unnecessary, and reported as
+	// extra rather than out of order.
+	for i := 1; i < len(path); i++ {
+		if path[i] < path[i-1] {
+			result.ChainOutOfOrder = true
+		}
+	}
+	for position, c := range chain {
+		if !used[position] {
+			result.ExtraCertificates = append(result.ExtraCertificates, extraCertificate{
+				Position: position,
+				Subject:  c.Subject.String(),
+				Issuer:   c.Issuer.String(),
+			})
+		}
+	}
+
+	last := chain[path[len(path)-1]]
+	result.ChainComplete = isChainAnchored(last, roots)
+	if result.ChainComplete {
+		result.AIAChainComplete = true
+		return result
+	}
+
+	// Fetch the missing intermediates
+	for i := 0; i < maxAIAFetches && !result.AIAChainComplete; i++ {
+		issuer, url := fetchIssuingCertificate(ctx, d, client, last)
+		if issuer == nil {
+			break
+		}
+		row := getCertificateRow(issuer)
+		result.FetchedIntermediates = append(result.FetchedIntermediates, aiaCertificate{
+			URL:               url,
+			Subject:           row.Subject,
+			Issuer:            row.Issuer,
+			SerialNumber:      row.SerialNumber,
+			FingerprintSHA256: row.FingerprintSHA256,
+			PEM:               row.PEM,
+		})
+		last = issuer
+		result.AIAChainComplete = isChainAnchored(last, roots)
+	}
+
+	return result
+}
+
+// Check if the certificate is self-signed, or issued by a trusted root
+func isChainAnchored(cert *x509.Certificate, roots *x509.CertPool) bool {
+	if isCertificateIssuedBy(cert, cert) {
+		return true
+	}
+	// Verify checks the validity period of the certificate before looking for
+	// its issuer, so check at a time the certificate is valid, or an expired
+	// certificate would hide a missing issuer
+	now := time.Now()
+	if now.After(cert.NotAfter) {
+		now = cert.NotAfter
+	} else if now.Before(cert.NotBefore) {
+		now = cert.NotBefore
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime: now,
+	})
+	// The chain is complete if the issuer was found, even if it failed for
+	// another reason, e.g. the issuer has expired
+	var unknownAuthority x509.UnknownAuthorityError
+	return err == nil || !errors.As(err, &unknownAuthority)
+}
+
+// Download the certificate which issued the given certificate from its issuing
+// certificate URLs. Returns nil if it could not be found.
+func fetchIssuingCertificate(ctx context.Context, d *plugin.QueryData, client *http.Client, cert *x509.Certificate) (*x509.Certificate, string) {
+	for _, url := range cert.IssuingCertificateURL {
+		certs, err := fetchAIACertificates(ctx, d, client, url)
+		if err != nil {
+			continue
+		}
+		for _, c := range certs {
+			if isCertificateIssuedBy(cert, c) {
+				return c, url
+			}
+		}
+	}
+	return nil, ""
+}
+
+// Download the certificates from an issuing certificate URL. Intermediates are
+// long-lived, so they are cached rather than fetched again for every query.
+func fetchAIACertificates(ctx context.Context, d *plugin.QueryData, client *http.Client, url string) ([]*x509.Certificate, error) {
+	cacheKey := "fetchAIACertificates-" + url
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.([]*x509.Certificate), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to retrieve %s: %s", url, resp.Status)
+	}
+
+	body, err := readResponseBody(resp, maxAIAResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCertificateBundle(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificates from %s: %v", url, err)
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, certs); err != nil {
+		plugin.Logger(ctx).Warn("fetchAIACertificates", "failed to cache certificates", err)
+	}
+	return certs, nil
+}
+
+// Parse certificates in any of the formats served from issuing certificate
+// URLs: DER, PEM or a PKCS#7 certs-only bundle
+func parseCertificateBundle(content []byte) ([]*x509.Certificate, error) {
+	if bytes.Contains(content, []byte("-----BEGIN")) {
+		return parsePEMCertificates(content)
+	}
+	if certs, err := x509.ParseCertificates(content); err == nil {
+		return certs, nil
+	}
+	return parsePKCS7Certificates(content)
+}
+
+// Parse the certificates from a DER encoded PKCS#7 signed data structure, as
+// described in RFC 2315
+func parsePKCS7Certificates(content []byte) ([]*x509.Certificate, error) {
+	input := cryptobyte.String(content)
+	var contentInfo, signedDataField, signedData cryptobyte.String
+	var contentType asn1.ObjectIdentifier
+	if !input.ReadASN1(&contentInfo, cryptobyte_asn1.SEQUENCE) ||
+		!contentInfo.ReadASN1ObjectIdentifier(&contentType) {
+		return nil, errors.New("unrecognized format")
+	}
+	if !contentType.Equal(oidPKCS7SignedData) {
+		return nil, fmt.Errorf("unsupported PKCS#7 content type %s", contentType)
+	}
+	if !contentInfo.ReadASN1(&signedDataField, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!signedDataField.ReadASN1(&signedData, cryptobyte_asn1.SEQUENCE) ||
+		// version
+		!signedData.SkipASN1(cryptobyte_asn1.INTEGER) ||
+		// digestAlgorithms
+		!signedData.SkipASN1(cryptobyte_asn1.SET) ||
+		// contentInfo
+		!signedData.SkipASN1(cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("failed to parse PKCS#7 signed data")
+	}
+
+	// certificates [0] IMPLICIT SET OF Certificate OPTIONAL
+	var certificates cryptobyte.String
+	var present bool
+	if !signedData.ReadOptionalASN1(&certificates, &present, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, errors.New("failed to parse PKCS#7 certificates")
+	}
+	if !present {
+		return nil, errors.New("no certificates found")
+	}
+
+	var certs []*x509.Certificate
+	for !certificates.Empty() {
+		var raw cryptobyte.String
+		if !certificates.ReadASN1Element(&raw, cryptobyte_asn1.SEQUENCE) {
+			return nil, errors.New("failed to parse PKCS#7 certificates")
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,224 @@
+package net
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Default CAA issuer domains of common certificate authorities, keyed by the
+// organization of the issuing certificate. Can be extended or overridden using
+// the caa_issuer_domains connection config.
+var defaultCAAIssuerDomains = map[string]string{
+	"Let's Encrypt":                "letsencrypt.org",
+	"Google Trust Services":        "pki.goog",
+	"Google Trust Services LLC":    "pki.goog",
+	"Amazon":                       "amazon.com",
+	"DigiCert Inc":                 "digicert.com",
+	"DigiCert, Inc.":               "digicert.com",
+	"Sectigo Limited":              "sectigo.com",
+	"COMODO CA Limited":            "comodoca.com",
+	"ZeroSSL":                      "sectigo.com",
+	"GlobalSign nv-sa":             "globalsign.com",
+	"GoDaddy.com, Inc.":            "godaddy.com",
+	"Starfield Technologies, Inc.": "starfieldtech.com",
+	"Entrust, Inc.":                "entrust.net",
+	"Microsoft Corporation":        "microsoft.com",
+	"SSL Corporation":              "ssl.com",
+	"Buypass AS-983163327":         "buypass.com",
+	"Actalis S.p.A.":               "actalis.it",
+	"Asseco Data Systems S.A.":     "certum.pl",
+}
+
+// CAA property tags defined in RFC 8659. A critical property with any other
+// tag forbids issuance.
+var knownCAATags = []string{"issue", "issuewild", "iodef"}
+
+type caaRecord struct {
+	Flag  uint8  `json:"flag"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// The CAA check for a single name of the certificate
+type caaCheck struct {
+	Name               string      `json:"name"`
+	RecordsDomain      string      `json:"records_domain,omitempty"`
+	Records            []caaRecord `json:"records,omitempty"`
+	AnyIssuerPermitted bool        `json:"any_issuer_permitted"`
+	PermittedIssuers   []string    `json:"permitted_issuers"`
+	IssuerPermitted    *bool       `json:"issuer_permitted,omitempty"`
+	Error              string      `json:"error,omitempty"`
+}
+
+type caaVerification struct {
+	Checks       []caaCheck
+	IssuerDomain string
+	Compliant    *bool
+}
+
+// Get the CAA issuer domain of the certificate authority that issued the
+// certificate, using the organization or common name of the issuer. Returns an
+// empty string if the issuer is not known.
+func getCAAIssuerDomain(ctx context.Context, d *plugin.QueryData, cert *x509.Certificate) string {
+	issuerDomains := map[string]string{}
+	for issuer, domain := range defaultCAAIssuerDomains {
+		issuerDomains[strings.ToLower(issuer)] = domain
+	}
+	for issuer, domain := range GetConfig(d.Connection).CAAIssuerDomains {
+		issuerDomains[strings.ToLower(issuer)] = domain
+	}
+
+	names := append([]string{}, cert.Issuer.Organization...)
+	names = append(names, cert.Issuer.CommonName)
+	for _, name := range names {
+		if domain, ok := issuerDomains[strings.ToLower(name)]; ok {
+			return strings.ToLower(domain)
+		}
+	}
+	return ""
+}
+
+// A resolver for CAA records, which caches the records of each domain so that
+// names of the certificate sharing a parent domain only query it once
+type caaResolver struct {
+	client    *dns.Client
+	dialer    *proxyDialer
+	dnsServer string
+	cache     map[string][]caaRecord
+}
+
+// Get the CAA records of the domain. A domain which doesn't exist has no
+// records.
+func (r *caaResolver) lookup(ctx context.Context, domain string) ([]caaRecord, error) {
+	if records, ok := r.cache[domain]; ok {
+		return records, nil
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeCAA)
+	m.RecursionDesired = true
+	resp, err := exchangeDNS(ctx, r.client, r.dialer, r.dnsServer, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("CAA lookup of %s failed: %s", domain, dns.RcodeToString[resp.Rcode])
+	}
+
+	records := []caaRecord{}
+	for _, answer := range resp.Answer {
+		// Aliases are followed by the DNS server, and returned along with the
+		// records of the target
+		if caa, ok := answer.(*dns.CAA); ok {
+			records = append(records, caaRecord{Flag: caa.Flag, Tag: caa.Tag, Value: caa.Value})
+		}
+	}
+	r.cache[domain] = records
+	return records, nil
+}
+
+// Find the relevant CAA record set for the name, as described in RFC 8659. The
+// name and each of its parent domains are checked in turn, up to but excluding
+// the root, until one of them has CAA records. Returns the domain the records
+// were found at.
+func (r *caaResolver) relevantRecords(ctx context.Context, name string) (string, []caaRecord, error) {
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		domain := strings.Join(labels[i:], ".")
+		records, err := r.lookup(ctx, domain)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(records) > 0 {
+			return domain, records, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// Check which certificate authorities may issue a certificate for the name,
+// and whether the issuer domain is one of them. Wildcard names are checked
+// against the issuewild properties, if there are any, and the issue
+// properties otherwise.
+func (r *caaResolver) check(ctx context.Context, name string, issuerDomain string) caaCheck {
+	check := caaCheck{Name: name}
+
+	wildcard := strings.HasPrefix(name, "*.")
+	recordsDomain, records, err := r.relevantRecords(ctx, strings.TrimPrefix(name, "*."))
+	if err != nil {
+		// Issuance is not permitted if the records can't be retrieved
+		check.Error = err.Error()
+		check.PermittedIssuers = []string{}
+		return check
+	}
+	check.RecordsDomain = recordsDomain
+	check.Records = records
+
+	tag := "issue"
+	if wildcard {
+		for _, record := range records {
+			if strings.EqualFold(record.Tag, "issuewild") {
+				tag = "issuewild"
+				break
+			}
+		}
+	}
+
+	hasIssueProperty := false
+	criticalUnknown := false
+	permitted := []string{}
+	for _, record := range records {
+		known := false
+		for _, knownTag := range knownCAATags {
+			if strings.EqualFold(record.Tag, knownTag) {
+				known = true
+			}
+		}
+		// The issuer critical flag is the most significant bit
+		if !known && record.Flag&128 != 0 {
+			criticalUnknown = true
+		}
+
+		if !strings.EqualFold(record.Tag, tag) {
+			continue
+		}
+		hasIssueProperty = true
+
+		// The issuer domain is followed by optional parameters, e.g.
+		// letsencrypt.org; validationmethods=dns-01. An empty issuer domain
+		// forbids issuance.
+		issuer := strings.TrimSpace(strings.SplitN(record.Value, ";", 2)[0])
+		if issuer != "" {
+			permitted = append(permitted, strings.ToLower(issuer))
+		}
+	}
+
+	switch {
+	case criticalUnknown:
+		permitted = []string{}
+	case !hasIssueProperty:
+		// Without CAA records, or properties for the type of name, any
+		// certificate authority may issue
+		check.AnyIssuerPermitted = true
+		permitted = nil
+	}
+	check.PermittedIssuers = permitted
+
+	if issuerDomain != "" {
+		issuerPermitted := check.AnyIssuerPermitted
+		for _, p := range permitted {
+			if p == issuerDomain {
+				issuerPermitted = true
+			}
+		}
+		check.IssuerPermitted = &issuerPermitted
+	}
+
+	return check
+}
@@ -0,0 +1,112 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Get the client certificate for mutual TLS from the given profile in the
+// connection config. An empty profile uses the client_certificate_path and
+// client_key_path settings. Returns nil if no client certificate is configured.
+func getClientCertificate(ctx context.Context, d *plugin.QueryData, profile string) (*tls.Certificate, error) {
+	config := GetConfig(d.Connection)
+
+	var certPath, keyPath string
+	if profile == "" {
+		if config.ClientCertificatePath == nil {
+			return nil, nil
+		}
+		certPath = *config.ClientCertificatePath
+		if config.ClientKeyPath != nil {
+			keyPath = *config.ClientKeyPath
+		}
+	} else {
+		settings, ok := config.ClientCertificates[profile]
+		if !ok {
+			names := maps.Keys(config.ClientCertificates)
+			slices.Sort(names)
+			return nil, fmt.Errorf("%s is not a valid client certificate profile. Possible values are: %s", profile, strings.Join(names, ", "))
+		}
+		certPath = settings["certificate_path"]
+		keyPath = settings["key_path"]
+	}
+	if certPath == "" {
+		return nil, fmt.Errorf("client certificate profile %s has no certificate_path", profile)
+	}
+
+	// The key can be stored in the same file as the certificate
+	if keyPath == "" {
+		keyPath = certPath
+	}
+
+	cacheKey := "getClientCertificate-" + profile
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(*tls.Certificate), nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate %s: %v", certPath, err)
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, &cert); err != nil {
+		plugin.Logger(ctx).Warn("getClientCertificate", "failed to cache client certificate", err)
+	}
+
+	return &cert, nil
+}
+
+// Presents the client certificate, if any, when the server requests one during
+// the handshake, and records the CAs the server accepts. A new request must be
+// used for each connection.
+type clientCertificateRequest struct {
+	certificate   *tls.Certificate
+	requested     bool
+	acceptableCAs []string
+}
+
+func newClientCertificateRequest(certificate *tls.Certificate) *clientCertificateRequest {
+	return &clientCertificateRequest{certificate: certificate}
+}
+
+// Used as tls.Config.GetClientCertificate
+func (r *clientCertificateRequest) getClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.requested = true
+	for _, ca := range info.AcceptableCAs {
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(ca, &name); err != nil {
+			r.acceptableCAs = append(r.acceptableCAs, hex.EncodeToString(ca))
+			continue
+		}
+		r.acceptableCAs = append(r.acceptableCAs, name.String())
+	}
+
+	// An empty certificate sends no certificate, leaving it to the server to
+	// decide whether to continue the handshake
+	if r.certificate == nil {
+		return &tls.Certificate{}, nil
+	}
+	return r.certificate, nil
+}
+
+// Get the acceptable CA names sent by the server. Returns nil if the server
+// didn't request a client certificate, or an empty list if it accepts any CA.
+func (r *clientCertificateRequest) requestedCAs() []string {
+	if !r.requested {
+		return nil
+	}
+	if r.acceptableCAs == nil {
+		return []string{}
+	}
+	return r.acceptableCAs
+}
@@ -8,8 +8,23 @@ import (
 )
 
 type netConfig struct {
-	Timeout   *int    `hcl:"timeout"`
-	DNSServer *string `hcl:"dns_server"`
+	Timeout               *int                         `hcl:"timeout"`
+	DNSServer             *string                      `hcl:"dns_server"`
+	CABundlePaths         []string                     `hcl:"ca_bundle_paths,optional"`
+	CTLogListPath         *string                      `hcl:"ct_log_list_path"`
+	CTProvider            *string                      `hcl:"ct_provider"`
+	CTProviderTimeout     *int                         `hcl:"ct_provider_timeout"`
+	CTProviderRateLimit   *float64                     `hcl:"ct_provider_rate_limit"`
+	ClientCertificatePath *string                      `hcl:"client_certificate_path"`
+	ClientKeyPath         *string                      `hcl:"client_key_path"`
+	ClientCertificates    map[string]map[string]string `hcl:"client_certificates,optional"`
+	Proxy                 *string                      `hcl:"proxy"`
+	WeakKeyBlocklistPaths []string                     `hcl:"weak_key_blocklist_paths,optional"`
+	CAAIssuerDomains      map[string]string            `hcl:"caa_issuer_domains,optional"`
+	TrustedRootSnapshot   *string                      `hcl:"trusted_root_snapshot"`
+	MaxConcurrency        *int                         `hcl:"max_concurrency"`
+	HandshakeRateLimit    *float64                     `hcl:"handshake_rate_limit"`
+	HandshakeDelay        *int                         `hcl:"handshake_delay"`
 }
 
 func ConfigInstance() interface{} {
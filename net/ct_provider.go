@@ -0,0 +1,131 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// A certificate transparency search provider, compatible with the crt.sh JSON
+// output, e.g. https://crt.sh/?identity=steampipe.io&output=json
+type ctProvider struct {
+	baseURL string
+	client  *http.Client
+	limiter *rate.Limiter
+}
+
+// Providers are shared across queries, so that the rate limit applies to all
+// requests made with the same settings
+var ctProviders sync.Map
+
+// Returns the certificate transparency provider for the connection
+func getCTProvider(ctx context.Context, d *plugin.QueryData) (*ctProvider, error) {
+	config := GetConfig(d.Connection)
+
+	// default to crt.sh
+	baseURL := "https://crt.sh/"
+	if config.CTProvider != nil {
+		baseURL = *config.CTProvider
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	// default to 30000ms, since crt.sh searches can be slow
+	timeout := 30000
+	if config.CTProviderTimeout != nil {
+		timeout = *config.CTProviderTimeout
+	}
+
+	// default to 1 request per second
+	rateLimit := 1.0
+	if config.CTProviderRateLimit != nil {
+		rateLimit = *config.CTProviderRateLimit
+	}
+
+	proxyURL, err := getProxyURL(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	var proxy string
+	if proxyURL != nil {
+		proxy = proxyURL.String()
+	}
+
+	key := fmt.Sprintf("%s|%d|%f|%s", baseURL, timeout, rateLimit, proxy)
+	provider, _ := ctProviders.LoadOrStore(key, &ctProvider{
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout:   time.Millisecond * time.Duration(timeout),
+			Transport: getProxyHTTPTransport(proxyURL),
+		},
+		limiter: rate.NewLimiter(rate.Limit(rateLimit), 1),
+	})
+	return provider.(*ctProvider), nil
+}
+
+// Search the provider for certificates matching the given query parameters
+func (p *ctProvider) search(ctx context.Context, params url.Values) ([]Cert, error) {
+	var certs []Cert
+	err := p.searchEach(ctx, params, func(c Cert) bool {
+		certs = append(certs, c)
+		return true
+	})
+	return certs, err
+}
+
+// Search the provider for certificates matching the given query parameters,
+// calling fn for each certificate as it is decoded from the response. Results
+// can be very large for popular domains, so they are streamed rather than
+// read at once, and the search stops as soon as fn returns false.
+func (p *ctProvider) searchEach(ctx context.Context, params url.Values, fn func(Cert) bool) error {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	params.Set("output", "json")
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve certificate transparency log: %v", err)
+	}
+	defer resp.Body.Close()
+
+	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !statusOK {
+		return fmt.Errorf("failed to complete the request for %s: %v", params.Encode(), resp.Status)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read certificate transparency log: %v", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("unexpected certificate transparency log response: %v", token)
+	}
+	for decoder.More() {
+		var c Cert
+		if err := decoder.Decode(&c); err != nil {
+			return fmt.Errorf("failed to read certificate transparency log: %v", err)
+		}
+		if !fn(c) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package net
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Certificate usages of TLSA records (RFC 7218)
+var daneUsageNames = map[uint8]string{
+	0: "PKIX-TA",
+	1: "PKIX-EE",
+	2: "DANE-TA",
+	3: "DANE-EE",
+}
+
+// The result of matching a TLSA record against the presented certificates
+type daneRecord struct {
+	Usage                      uint8  `json:"usage"`
+	UsageName                  string `json:"usage_name,omitempty"`
+	Selector                   uint8  `json:"selector"`
+	MatchingType               uint8  `json:"matching_type"`
+	CertificateAssociationData string `json:"certificate_association_data"`
+	Matched                    bool   `json:"matched"`
+	MatchedPosition            *int   `json:"matched_position,omitempty"`
+	Error                      string `json:"error,omitempty"`
+}
+
+type daneVerification struct {
+	Records []daneRecord
+	Valid   *bool
+	DNSSEC  bool
+}
+
+// Lookup the TLSA records of the name using the DNS server from the connection
+// config. Also returns whether the DNS server authenticated the records using
+// DNSSEC.
+func lookupTLSA(ctx context.Context, d *plugin.QueryData, name string) ([]*dns.TLSA, bool, error) {
+	c := new(dns.Client)
+	c.Timeout = GetConfigTimeout(ctx, d)
+
+	dialer, err := getProxyDialer(ctx, d, c.Timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeTLSA)
+	m.RecursionDesired = true
+	// Ask the server to report whether the answer was validated with DNSSEC
+	m.SetEdns0(4096, true)
+	m.AuthenticatedData = true
+
+	r, err := exchangeDNS(ctx, c, dialer, GetConfigDNSServerAndPort(ctx, d), m)
+	if err != nil {
+		return nil, false, err
+	}
+	if r.Rcode == dns.RcodeNameError {
+		return nil, r.AuthenticatedData, nil
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, false, fmt.Errorf("TLSA lookup of %s failed: %s", name, dns.RcodeToString[r.Rcode])
+	}
+
+	var records []*dns.TLSA
+	for _, answer := range r.Answer {
+		if tlsa, ok := answer.(*dns.TLSA); ok {
+			records = append(records, tlsa)
+		}
+	}
+	return records, r.AuthenticatedData, nil
+}
+
+// Verify the presented certificates against the TLSA records, as described in
+// RFC 6698 and RFC 7671. The chain is the list of presented certificates,
+// starting with the leaf certificate. PKIX usages also require the chain to be
+// trusted by the roots, and valid for the hostname.
+func verifyDANE(records []*dns.TLSA, chain []*x509.Certificate, roots *x509.CertPool, hostname string) ([]daneRecord, bool) {
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	// Certificates in the chains trusted by the roots, for the PKIX usages
+	pkixChains, pkixErr := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       hostname,
+	})
+
+	valid := false
+	var results []daneRecord
+	for _, record := range records {
+		result := daneRecord{
+			Usage:                      record.Usage,
+			UsageName:                  daneUsageNames[record.Usage],
+			Selector:                   record.Selector,
+			MatchingType:               record.MatchingType,
+			CertificateAssociationData: record.Certificate,
+		}
+
+		// End entity usages only match the leaf certificate, while trust
+		// anchor usages match any other presented certificate. PKIX-TA also
+		// matches a trusted root, which servers usually don't present.
+		type candidate struct {
+			position *int
+			cert     *x509.Certificate
+		}
+		var candidates []candidate
+		switch record.Usage {
+		case 1, 3:
+			position := 0
+			candidates = append(candidates, candidate{&position, leaf})
+		case 0, 2:
+			for i, c := range chain[1:] {
+				position := i + 1
+				candidates = append(candidates, candidate{&position, c})
+			}
+			if record.Usage == 0 {
+				for _, pkixChain := range pkixChains {
+					candidates = append(candidates, candidate{nil, pkixChain[len(pkixChain)-1]})
+				}
+			}
+		default:
+			result.Error = fmt.Sprintf("unsupported certificate usage %d", record.Usage)
+			results = append(results, result)
+			continue
+		}
+
+		for _, candidate := range candidates {
+			c := candidate.cert
+			data, err := dns.CertificateToDANE(record.Selector, record.MatchingType, c)
+			if err != nil {
+				result.Error = fmt.Sprintf("unsupported selector %d or matching type %d", record.Selector, record.MatchingType)
+				break
+			}
+			if !strings.EqualFold(data, record.Certificate) {
+				continue
+			}
+
+			switch record.Usage {
+			case 0:
+				// The trust anchor must be part of a trusted chain
+				if pkixErr != nil {
+					result.Error = pkixErr.Error()
+				} else if !isCertificateInChains(c, pkixChains) {
+					result.Error = "the matched certificate is not part of a trusted chain"
+				}
+			case 1:
+				if pkixErr != nil {
+					result.Error = pkixErr.Error()
+				}
+			case 2:
+				// The matched certificate is the trust anchor for the chain
+				anchor := x509.NewCertPool()
+				anchor.AddCert(c)
+				if _, err := leaf.Verify(x509.VerifyOptions{
+					Roots:         anchor,
+					Intermediates: intermediates,
+					DNSName:       hostname,
+				}); err != nil {
+					result.Error = err.Error()
+				}
+			}
+
+			result.MatchedPosition = candidate.position
+			result.Matched = result.Error == ""
+			break
+		}
+
+		if result.Matched {
+			valid = true
+		}
+		results = append(results, result)
+	}
+
+	return results, valid
+}
+
+// Check if the certificate is part of any of the chains
+func isCertificateInChains(cert *x509.Certificate, chains [][]*x509.Certificate) bool {
+	for _, chain := range chains {
+		for _, c := range chain {
+			if c.Equal(cert) {
+				return true
+			}
+		}
+	}
+	return false
+}
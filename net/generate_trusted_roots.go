@@ -0,0 +1,81 @@
+//go:build ignore
+
+// Generates trusted_roots.csv, the snapshot of root certificates embedded in
+// the plugin, from the CCADB report of included root certificates. Only the
+// columns read by the plugin are kept. Run with go generate, e.g.
+//
+//	go generate ./net
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var columns = []string{"CA Owner", "Apple Status", "Chrome Status", "Microsoft Status", "Mozilla Status", "X.509 Certificate (PEM)"}
+
+func main() {
+	url := flag.String("url", "https://ccadb.my.salesforce-sites.com/ccadb/AllIncludedRootCertsCSV", "URL of the CCADB report")
+	output := flag.String("output", "trusted_roots.csv", "path of the generated snapshot")
+	flag.Parse()
+
+	resp, err := http.Get(*url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("failed to download %s: %s", *url, resp.Status)
+	}
+
+	reader := csv.NewReader(resp.Body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(records) < 2 {
+		log.Fatalf("%s has no roots", *url)
+	}
+
+	index := map[string]int{}
+	for i, name := range records[0] {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var positions []int
+	for _, name := range columns {
+		i, ok := index[strings.ToLower(name)]
+		if !ok {
+			log.Fatalf("%s has no %s column", *url, name)
+		}
+		positions = append(positions, i)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Write(columns)
+	for _, record := range records[1:] {
+		row := make([]string, len(positions))
+		for i, position := range positions {
+			if position < len(record) {
+				// PEM values are quoted with ' in some reports
+				row[i] = strings.Trim(strings.TrimSpace(record[position]), "'")
+			}
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %d roots to %s\n", len(records)-1, *output)
+}
@@ -0,0 +1,151 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Default number of concurrent handshakes to a host when scanning the
+// protocols and cipher suites of a server
+const defaultMaxConcurrency = 10
+
+// Limiters which haven't been used for this long are removed, so that
+// scanning many hosts doesn't keep a limiter for each of them
+const handshakeLimiterIdleTimeout = 10 * time.Minute
+
+// Limits the rate and concurrency of TLS handshakes to a single host, so that
+// scans don't trip web application firewalls or intrusion detection systems
+type handshakeLimiter struct {
+	limiter *rate.Limiter
+	slots   chan struct{}
+	delay   time.Duration
+
+	// Number of handshakes holding or waiting for a slot, and when the limiter
+	// was last used, guarded by handshakeLimitersMutex
+	users    int
+	lastUsed time.Time
+}
+
+// Limiters are shared across queries, so that the limits apply to all
+// handshakes made to the same host with the same settings
+var (
+	handshakeLimiters      = map[string]*handshakeLimiter{}
+	handshakeLimitersMutex sync.Mutex
+)
+
+// Returns the maximum number of concurrent handshakes from the connection
+// config
+func getMaxConcurrency(d *plugin.QueryData) int {
+	config := GetConfig(d.Connection)
+	if config.MaxConcurrency != nil && *config.MaxConcurrency > 0 {
+		return *config.MaxConcurrency
+	}
+	return defaultMaxConcurrency
+}
+
+// Returns the handshake limiter for the host of the address
+func getHandshakeLimiter(ctx context.Context, d *plugin.QueryData, address string) (*handshakeLimiter, error) {
+	config := GetConfig(d.Connection)
+
+	// default to no limit
+	rateLimit := rate.Inf
+	if config.HandshakeRateLimit != nil {
+		if *config.HandshakeRateLimit <= 0 {
+			return nil, fmt.Errorf("handshake_rate_limit must be greater than 0")
+		}
+		rateLimit = rate.Limit(*config.HandshakeRateLimit)
+	}
+
+	var delay time.Duration
+	if config.HandshakeDelay != nil {
+		delay = time.Millisecond * time.Duration(*config.HandshakeDelay)
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	concurrency := getMaxConcurrency(d)
+
+	handshakeLimitersMutex.Lock()
+	defer handshakeLimitersMutex.Unlock()
+
+	// Remove the limiters which are idle
+	now := time.Now()
+	for key, limiter := range handshakeLimiters {
+		if limiter.users == 0 && now.Sub(limiter.lastUsed) > handshakeLimiterIdleTimeout {
+			delete(handshakeLimiters, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s|%f|%d|%d", host, rateLimit, delay, concurrency)
+	limiter, ok := handshakeLimiters[key]
+	if !ok {
+		limiter = &handshakeLimiter{
+			limiter: rate.NewLimiter(rateLimit, 1),
+			slots:   make(chan struct{}, concurrency),
+			delay:   delay,
+		}
+		handshakeLimiters[key] = limiter
+	}
+	limiter.lastUsed = now
+	return limiter, nil
+}
+
+// Wait until a handshake can be started, within the concurrency and rate
+// limits. Returns an error if the context is cancelled while waiting. Every
+// successful wait must be followed by a call to done or release.
+func (l *handshakeLimiter) wait(ctx context.Context) error {
+	l.use(1)
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		l.use(-1)
+		return ctx.Err()
+	}
+	if err := l.limiter.Wait(ctx); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+// Pause after a handshake for the configured delay, and release its slot.
+// Returns an error if the context is cancelled while waiting.
+func (l *handshakeLimiter) done(ctx context.Context) error {
+	defer l.release()
+	if l.delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(l.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Release the slot of a handshake without pausing, e.g. when the scan stops
+func (l *handshakeLimiter) release() {
+	<-l.slots
+	l.use(-1)
+}
+
+// Track the handshakes using the limiter, so that it isn't removed while in
+// use
+func (l *handshakeLimiter) use(delta int) {
+	handshakeLimitersMutex.Lock()
+	defer handshakeLimitersMutex.Unlock()
+	l.users += delta
+	l.lastUsed = time.Now()
+}
@@ -0,0 +1,223 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP nonce extension, see RFC 8954
+var oidExtensionOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// Largest OCSP response read from a responder
+const maxOCSPResponseSize = 64 * 1024
+
+// Create an OCSP request for the certificate. If nonce is not empty, it is
+// added as a request extension, which the ocsp package doesn't support.
+func createOCSPRequest(cert, issuer *x509.Certificate, nonce []byte) ([]byte, error) {
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil || len(nonce) == 0 {
+		return request, err
+	}
+
+	// Extract the requestList from OCSPRequest -> TBSRequest, and wrap it in
+	// a new TBSRequest with the nonce in its requestExtensions
+	input := cryptobyte.String(request)
+	var ocspRequest, tbsRequest, requestList cryptobyte.String
+	if !input.ReadASN1(&ocspRequest, cryptobyte_asn1.SEQUENCE) ||
+		!ocspRequest.ReadASN1(&tbsRequest, cryptobyte_asn1.SEQUENCE) ||
+		!tbsRequest.ReadASN1Element(&requestList, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("failed to parse OCSP request")
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddBytes(requestList)
+			b.AddASN1(cryptobyte_asn1.Tag(2).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1ObjectIdentifier(oidExtensionOCSPNonce)
+						b.AddASN1(cryptobyte_asn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+							b.AddASN1OctetString(nonce)
+						})
+					})
+				})
+			})
+		})
+	})
+	return b.Bytes()
+}
+
+// Get the nonce from the responseExtensions of an OCSP response. The ocsp
+// package only exposes the singleExtensions, so the response data has to be
+// parsed here. Returns nil if the response has no nonce.
+func getOCSPResponseNonce(response *ocsp.Response) ([]byte, error) {
+	input := cryptobyte.String(response.TBSResponseData)
+	var responseData cryptobyte.String
+	if !input.ReadASN1(&responseData, cryptobyte_asn1.SEQUENCE) ||
+		// version [0] EXPLICIT DEFAULT v1
+		!responseData.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		// responderID, either byName [1] or byKey [2]
+		!(responseData.SkipOptionalASN1(cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()) &&
+			responseData.SkipOptionalASN1(cryptobyte_asn1.Tag(2).Constructed().ContextSpecific())) ||
+		// producedAt
+		!responseData.SkipASN1(cryptobyte_asn1.GeneralizedTime) ||
+		// responses
+		!responseData.SkipASN1(cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("failed to parse OCSP response data")
+	}
+
+	// responseExtensions [1] EXPLICIT Extensions OPTIONAL
+	var extensionsField cryptobyte.String
+	var present bool
+	if !responseData.ReadOptionalASN1(&extensionsField, &present, cryptobyte_asn1.Tag(1).Constructed().ContextSpecific()) {
+		return nil, errors.New("failed to parse OCSP response extensions")
+	}
+	if !present {
+		return nil, nil
+	}
+
+	var extensions cryptobyte.String
+	if !extensionsField.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("failed to parse OCSP response extensions")
+	}
+	for !extensions.Empty() {
+		var extension cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		var value []byte
+		if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) ||
+			!extension.ReadASN1ObjectIdentifier(&oid) ||
+			!extension.SkipOptionalASN1(cryptobyte_asn1.BOOLEAN) ||
+			!extension.ReadASN1Bytes(&value, cryptobyte_asn1.OCTET_STRING) {
+			return nil, errors.New("failed to parse OCSP response extension")
+		}
+		if !oid.Equal(oidExtensionOCSPNonce) {
+			continue
+		}
+
+		// The nonce should be an OCTET STRING, but some responders return the
+		// raw bytes instead
+		nonce := cryptobyte.String(value)
+		var inner []byte
+		if nonce.ReadASN1Bytes(&inner, cryptobyte_asn1.OCTET_STRING) && nonce.Empty() {
+			return inner, nil
+		}
+		return value, nil
+	}
+	return nil, nil
+}
+
+// Generate a random nonce for an OCSP request
+func newOCSPNonce() ([]byte, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// Send the OCSP request to the responder, returning the raw response
+func sendOCSPRequest(ctx context.Context, client *http.Client, responderURL string, request []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", responderURL, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Connection", "close")
+	req.Header.Set("User-Agent", "Steampipe")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("OCSP responder returned %s", resp.Status)
+	}
+	return readResponseBody(resp, maxOCSPResponseSize)
+}
+
+// Parse the OCSP response for the certificate without checking its signature,
+// so that a response with an invalid signature can still be reported. The ocsp
+// package checks the signature of the response against the responder
+// certificate included in it, if any, so the certificates are removed from the
+// BasicOCSPResponse before parsing, and the first one is parsed here instead.
+func parseOCSPResponseUnverified(body []byte, cert *x509.Certificate) (*ocsp.Response, error) {
+	input := cryptobyte.String(body)
+	var ocspResponse, responseStatus, responseBytesField, responseBytes, responseType, basicResponse, tbsResponseData, signatureAlgorithm, signature cryptobyte.String
+	var hasResponseBytes bool
+	if !input.ReadASN1(&ocspResponse, cryptobyte_asn1.SEQUENCE) ||
+		!ocspResponse.ReadASN1Element(&responseStatus, cryptobyte_asn1.ENUM) ||
+		!ocspResponse.ReadOptionalASN1(&responseBytesField, &hasResponseBytes, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, ocsp.ParseError("failed to parse OCSP response")
+	}
+	// Unsuccessful responses have no response bytes, and are reported by the
+	// ocsp package as a ResponseError
+	if !hasResponseBytes {
+		return ocsp.ParseResponseForCert(body, cert, nil)
+	}
+
+	var certificatesField cryptobyte.String
+	var hasCertificates bool
+	if !responseBytesField.ReadASN1(&responseBytes, cryptobyte_asn1.SEQUENCE) ||
+		!responseBytes.ReadASN1Element(&responseType, cryptobyte_asn1.OBJECT_IDENTIFIER) ||
+		!responseBytes.ReadASN1(&basicResponse, cryptobyte_asn1.OCTET_STRING) ||
+		!basicResponse.ReadASN1(&basicResponse, cryptobyte_asn1.SEQUENCE) ||
+		!basicResponse.ReadASN1Element(&tbsResponseData, cryptobyte_asn1.SEQUENCE) ||
+		!basicResponse.ReadASN1Element(&signatureAlgorithm, cryptobyte_asn1.SEQUENCE) ||
+		!basicResponse.ReadASN1Element(&signature, cryptobyte_asn1.BIT_STRING) ||
+		!basicResponse.ReadOptionalASN1(&certificatesField, &hasCertificates, cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) {
+		return nil, ocsp.ParseError("failed to parse OCSP response")
+	}
+	if !hasCertificates {
+		return ocsp.ParseResponseForCert(body, cert, nil)
+	}
+
+	var certificates, responderCertificate cryptobyte.String
+	if !certificatesField.ReadASN1(&certificates, cryptobyte_asn1.SEQUENCE) ||
+		!certificates.ReadASN1Element(&responderCertificate, cryptobyte_asn1.SEQUENCE) {
+		return nil, ocsp.ParseError("failed to parse OCSP response certificates")
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddBytes(responseStatus)
+		b.AddASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddBytes(responseType)
+				b.AddASN1(cryptobyte_asn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddBytes(tbsResponseData)
+						b.AddBytes(signatureAlgorithm)
+						b.AddBytes(signature)
+					})
+				})
+			})
+		})
+	})
+	stripped, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(stripped, cert, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.Certificate, err = x509.ParseCertificate(responderCertificate)
+	if err != nil {
+		return nil, ocsp.ParseError("failed to parse OCSP responder certificate: " + err.Error())
+	}
+	return response, nil
+}
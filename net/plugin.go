@@ -15,12 +15,18 @@ func Plugin(ctx context.Context) *plugin.Plugin {
 		},
 		DefaultTransform: transform.FromGo().NullIfZero(),
 		TableMap: map[string]*plugin.Table{
-			"net_certificate":    tableNetCertificate(ctx),
-			"net_connection":     tableNetConnection(ctx),
-			"net_dns_record":     tableNetDNSRecord(ctx),
-			"net_dns_reverse":    tableNetDNSReverse(ctx),
-			"net_http_request":   tableNetHTTPRequest(),
-			"net_tls_connection": tableNetTLSConnection(ctx),
+			"net_certificate":       tableNetCertificate(ctx),
+			"net_certificate_chain": tableNetCertificateChain(ctx),
+			"net_certificate_file":  tableNetCertificateFile(ctx),
+			"net_connection":        tableNetConnection(ctx),
+			"net_crl":               tableNetCRL(ctx),
+			"net_ct_log_entry":      tableNetCTLogEntry(ctx),
+			"net_dns_record":        tableNetDNSRecord(ctx),
+			"net_dns_reverse":       tableNetDNSReverse(ctx),
+			"net_http_request":      tableNetHTTPRequest(),
+			"net_ocsp":              tableNetOCSP(ctx),
+			"net_tls_connection":    tableNetTLSConnection(ctx),
+			"net_trusted_root":      tableNetTrustedRoot(ctx),
 		},
 	}
 	return p
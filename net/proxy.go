@@ -0,0 +1,214 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Get the proxy for the query, from the proxy column or the connection config.
+// An empty proxy column connects directly, even if a proxy is configured.
+// Returns nil if no proxy should be used.
+func getProxyURL(ctx context.Context, d *plugin.QueryData) (*url.URL, error) {
+	var proxyURL string
+	if d.EqualsQuals["proxy"] != nil {
+		proxyURL = d.EqualsQualString("proxy")
+	} else if config := GetConfig(d.Connection); config.Proxy != nil {
+		proxyURL = *config.Proxy
+	}
+	if proxyURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %v", proxyURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%s is not a valid proxy scheme. Possible values are: http, https, socks5 and socks5h", u.Scheme)
+	}
+	return u, nil
+}
+
+// Dials TCP connections either directly, or through an HTTP CONNECT or SOCKS5
+// proxy
+type proxyDialer struct {
+	proxy   *url.URL
+	timeout time.Duration
+	// Called once the TCP connection to the address, or to the proxy, is
+	// opened, as in net.Dialer
+	control func(network, address string, c syscall.RawConn) error
+}
+
+// Get the dialer for the query, using the proxy from getProxyURL
+func getProxyDialer(ctx context.Context, d *plugin.QueryData, timeout time.Duration) (*proxyDialer, error) {
+	proxyURL, err := getProxyURL(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyDialer{proxy: proxyURL, timeout: timeout}, nil
+}
+
+// Connect to the address on the named network. Only TCP connections can be
+// made through a proxy.
+func (p *proxyDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: p.timeout, Control: p.control}
+	if p.proxy == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("%s connections are not supported through a proxy", network)
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	switch p.proxy.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if p.proxy.User != nil {
+			password, _ := p.proxy.User.Password()
+			auth = &proxy.Auth{User: p.proxy.User.Username(), Password: password}
+		}
+		socks, err := proxy.SOCKS5("tcp", p.proxy.Host, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, network, address)
+	default:
+		return p.dialConnect(ctx, dialer, address)
+	}
+}
+
+// Open a tunnel to the address through an HTTP proxy, using the CONNECT method
+func (p *proxyDialer) dialConnect(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	proxyAddr := p.proxy.Host
+	if p.proxy.Port() == "" {
+		port := "80"
+		if p.proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(p.proxy.Hostname(), port)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %v", proxyAddr, err)
+	}
+	if p.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.proxy.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect to proxy %s: %v", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+
+	// Limit the time spent waiting for the proxy to open the tunnel
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if p.proxy.User != nil {
+		password, _ := p.proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT request to proxy %s: %v", proxyAddr, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy %s: %v", proxyAddr, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxyAddr, address, resp.Status)
+	}
+
+	// Servers may send data as soon as the tunnel is open, e.g. an SMTP
+	// greeting, which could already be buffered by the reader
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// A connection which reads any data buffered while reading the proxy response
+// before reading from the connection itself
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// HTTP transports, keyed by proxy URL, so that idle connections are reused
+// across queries
+var proxyHTTPTransports sync.Map
+
+// Get an HTTP client for the query, which sends requests through the proxy
+// from getProxyURL
+func getProxyHTTPClient(ctx context.Context, d *plugin.QueryData) (*http.Client, error) {
+	proxyURL, err := getProxyURL(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return http.DefaultClient, nil
+	}
+	return &http.Client{Transport: getSharedProxyHTTPTransport(proxyURL)}, nil
+}
+
+// Get the HTTP transport shared across queries for the given proxy, or the
+// default transport if it is nil
+func getSharedProxyHTTPTransport(proxyURL *url.URL) http.RoundTripper {
+	if proxyURL == nil {
+		return http.DefaultTransport
+	}
+	transport, _ := proxyHTTPTransports.LoadOrStore(proxyURL.String(), getProxyHTTPTransport(proxyURL))
+	return transport.(*http.Transport)
+}
+
+// Get an HTTP transport which sends requests through the given proxy. If it is
+// nil, the default transport settings are kept. The socks5h scheme is handled
+// as socks5, as the transport always leaves name resolution to a SOCKS5 proxy.
+func getProxyHTTPTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		u := *proxyURL
+		u.Scheme = strings.TrimSuffix(u.Scheme, "h")
+		transport.Proxy = http.ProxyURL(&u)
+	}
+	return transport
+}
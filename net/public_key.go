@@ -0,0 +1,168 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// Ed448 public key algorithm (RFC 8410), which is not supported by the x509
+// package
+var oidPublicKeyEd448 = asn1.ObjectIdentifier{1, 3, 101, 113}
+
+// RSA keys with a smaller modulus are considered weak, as recommended by
+// NIST SP 800-131A
+const minRSAModulusBits = 2048
+
+type publicKeyDetails struct {
+	Algorithm      string
+	Length         int
+	Curve          string
+	Exponent       int
+	WeakKeyReasons []string
+}
+
+// Get the algorithm, size and curve of the public key of the certificate, along
+// with any weakness that can be detected from the key itself
+func getPublicKeyDetails(cert *x509.Certificate) publicKeyDetails {
+	details := publicKeyDetails{Algorithm: cert.PublicKeyAlgorithm.String()}
+
+	switch publicKey := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		details.Length = publicKey.N.BitLen()
+		details.Exponent = publicKey.E
+		if details.Length < minRSAModulusBits {
+			details.WeakKeyReasons = append(details.WeakKeyReasons, fmt.Sprintf("RSA modulus smaller than %d bits", minRSAModulusBits))
+		}
+		if publicKey.E == 1 || publicKey.E == 3 {
+			details.WeakKeyReasons = append(details.WeakKeyReasons, fmt.Sprintf("RSA exponent %d", publicKey.E))
+		}
+	case *ecdsa.PublicKey:
+		details.Length = publicKey.Curve.Params().BitSize
+		details.Curve = publicKey.Curve.Params().Name
+	case ed25519.PublicKey:
+		details.Length = 256
+		details.Curve = "Ed25519"
+	default:
+		algorithm := getPublicKeyAlgorithmIdentifier(cert)
+		switch {
+		case cert.PublicKeyAlgorithm == x509.DSA:
+			// The size of a DSA key is the size of the prime p in the domain
+			// parameters
+			var params struct {
+				P, Q, G *big.Int
+			}
+			if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err == nil {
+				details.Length = params.P.BitLen()
+			}
+		case algorithm.Algorithm.Equal(oidPublicKeyEd448):
+			// Keys the x509 package doesn't support are left unparsed, so are
+			// identified by the algorithm in the subject public key info
+			details.Algorithm = "Ed448"
+			details.Length = 448
+			details.Curve = "Ed448"
+		}
+	}
+
+	return details
+}
+
+// Returns the algorithm, along with its parameters, from the subject public key
+// info of the certificate
+func getPublicKeyAlgorithmIdentifier(cert *x509.Certificate) pkix.AlgorithmIdentifier {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return pkix.AlgorithmIdentifier{}
+	}
+	return spki.Algorithm
+}
+
+// A set of RSA keys generated by the Debian OpenSSL random number generator
+// bug (CVE-2008-0166), keyed by the fingerprint used in the openssl-blacklist
+// files
+type weakKeyBlocklist map[string]bool
+
+// Returns the blocklist loaded from the configured weak_key_blocklist_paths.
+// Returns nil if none are configured.
+func getWeakKeyBlocklist(ctx context.Context, d *plugin.QueryData) (weakKeyBlocklist, error) {
+	config := GetConfig(d.Connection)
+	if len(config.WeakKeyBlocklistPaths) == 0 {
+		return nil, nil
+	}
+
+	cacheKey := "getWeakKeyBlocklist"
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(weakKeyBlocklist), nil
+	}
+
+	blocklist := weakKeyBlocklist{}
+	for _, pattern := range config.WeakKeyBlocklistPaths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weak_key_blocklist_paths pattern %s: %v", pattern, err)
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read weak key blocklist %s: %v", path, err)
+			}
+			scanner := bufio.NewScanner(bytes.NewReader(content))
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				blocklist[strings.ToLower(line)] = true
+			}
+		}
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, blocklist); err != nil {
+		plugin.Logger(ctx).Warn("getWeakKeyBlocklist", "failed to cache weak key blocklist", err)
+	}
+
+	return blocklist, nil
+}
+
+// Check if the RSA key is listed in the blocklist. As in openssl-vulnkey, keys
+// are listed by the last 20 hex characters of the SHA-1 hash of the modulus,
+// formatted as "Modulus=<uppercase hex>\n".
+func (b weakKeyBlocklist) contains(cert *x509.Certificate) bool {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || len(b) == 0 {
+		return false
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", publicKey.N)))
+	fingerprint := hex.EncodeToString(sum[:])
+	return b[fingerprint[len(fingerprint)-20:]]
+}
+
+// Flag the certificate, and the certificates in its chain, as weak if their
+// keys are listed in the blocklist
+func (b weakKeyBlocklist) check(row *tableNetCertificateRow) {
+	if row.rawCert != nil && b.contains(row.rawCert) {
+		row.WeakKeyReasons = append(row.WeakKeyReasons, "Debian weak key")
+		row.WeakKey = true
+	}
+	for i := range row.Chain {
+		b.check(&row.Chain[i])
+	}
+}
@@ -0,0 +1,159 @@
+package net
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// SSL v2 message types
+const (
+	sslv2MessageError       = 0
+	sslv2MessageClientHello = 1
+	sslv2MessageServerHello = 4
+)
+
+// The result of an SSL v2 handshake probe
+type sslv2HandshakeResult struct {
+	CipherSpecs   []uint32
+	LocalAddress  string
+	RemoteAddress string
+}
+
+// Send a hand-built SSL v2 CLIENT-HELLO offering the given cipher specs, and
+// read the SERVER-HELLO. The server replies with the offered cipher specs it
+// supports, or an error if it supports none of them.
+func probeSSLv2(ctx context.Context, dialer *proxyDialer, address string, cipherSpecs []uint32) (*sslv2HandshakeResult, error) {
+	hello, err := buildSSLv2ClientHello(cipherSpecs)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, closeConn, err := dialRawHandshake(ctx, dialer, address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	// A 2 byte record header, with the most significant bit set
+	record := []byte{0x80 | byte(len(hello)>>8), byte(len(hello))}
+	if _, err := conn.Write(append(record, hello...)); err != nil {
+		return nil, err
+	}
+
+	specs, err := readSSLv2ServerHello(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return &sslv2HandshakeResult{
+		CipherSpecs:   specs,
+		LocalAddress:  conn.LocalAddr().String(),
+		RemoteAddress: conn.RemoteAddr().String(),
+	}, nil
+}
+
+// Build an SSL v2 CLIENT-HELLO message offering the given cipher specs
+func buildSSLv2ClientHello(cipherSpecs []uint32) ([]byte, error) {
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(sslv2MessageClientHello)
+	b.AddUint16(0x0002)
+	b.AddUint16(uint16(len(cipherSpecs) * 3))
+	// No session ID
+	b.AddUint16(0)
+	b.AddUint16(uint16(len(challenge)))
+	for _, spec := range cipherSpecs {
+		b.AddUint24(spec)
+	}
+	b.AddBytes(challenge)
+	return b.Bytes()
+}
+
+// Read the SSL v2 SERVER-HELLO, and return the cipher specs it lists. Servers
+// which don't support SSL v2 usually reply with a TLS alert, or close the
+// connection.
+func readSSLv2ServerHello(r io.Reader) ([]uint32, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read server response: %v", err)
+	}
+
+	// A TLS record in reply, e.g. a protocol_version alert
+	if header[0] == recordTypeAlert || header[0] == recordTypeHandshake {
+		return nil, errors.New("server does not support SSL v2")
+	}
+
+	// Records have a 2 byte header if the most significant bit is set, or a 3
+	// byte header with a padding length otherwise
+	var length, padding int
+	if header[0]&0x80 != 0 {
+		length = int(header[0]&0x7f)<<8 | int(header[1])
+	} else {
+		length = int(header[0]&0x3f)<<8 | int(header[1])
+		extra := make([]byte, 1)
+		if _, err := io.ReadFull(r, extra); err != nil {
+			return nil, fmt.Errorf("failed to read server response: %v", err)
+		}
+		padding = int(extra[0])
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("failed to read server response: %v", err)
+	}
+	if padding > len(message) {
+		return nil, errors.New("malformed SSL v2 record")
+	}
+	message = message[:len(message)-padding]
+
+	s := cryptobyte.String(message)
+	var messageType uint8
+	if !s.ReadUint8(&messageType) {
+		return nil, errors.New("malformed SSL v2 message")
+	}
+	switch messageType {
+	case sslv2MessageError:
+		var code uint16
+		s.ReadUint16(&code)
+		return nil, fmt.Errorf("remote error: ssl: error(0x%04x)", code)
+	case sslv2MessageServerHello:
+	default:
+		return nil, fmt.Errorf("unexpected SSL v2 message type %d", messageType)
+	}
+
+	var sessionIDHit, certificateType uint8
+	var version, certificateLength, cipherSpecsLength, connectionIDLength uint16
+	if !s.ReadUint8(&sessionIDHit) ||
+		!s.ReadUint8(&certificateType) ||
+		!s.ReadUint16(&version) ||
+		!s.ReadUint16(&certificateLength) ||
+		!s.ReadUint16(&cipherSpecsLength) ||
+		!s.ReadUint16(&connectionIDLength) ||
+		!s.Skip(int(certificateLength)) {
+		return nil, errors.New("malformed SSL v2 SERVER-HELLO")
+	}
+	if version != 0x0002 {
+		return nil, fmt.Errorf("server negotiated %s instead", tlsVersionName(version))
+	}
+
+	var specs []uint32
+	for i := 0; i < int(cipherSpecsLength)/3; i++ {
+		var spec uint32
+		if !s.ReadUint24(&spec) {
+			return nil, errors.New("malformed SSL v2 SERVER-HELLO")
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
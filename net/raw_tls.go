@@ -0,0 +1,487 @@
+package net
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	"github.com/turbot/steampipe-plugin-net/constants"
+)
+
+// Timeout for raw handshake probes, if the dialer has none
+const rawHandshakeTimeout = 10 * time.Second
+
+// TLS record and handshake message types
+const (
+	recordTypeAlert          = 21
+	recordTypeHandshake      = 22
+	handshakeTypeClientHello = 1
+	handshakeTypeServerHello = 2
+)
+
+// TLS extensions sent in the raw ClientHello
+const (
+	extensionServerName          = 0
+	extensionSupportedGroups     = 10
+	extensionECPointFormats      = 11
+	extensionSignatureAlgorithms = 13
+	extensionSupportedVersions   = 43
+	extensionPSKKeyExchangeModes = 45
+	extensionKeyShare            = 51
+	extensionRenegotiationInfo   = 0xff01
+)
+
+// Signaling cipher suite values, which are not real cipher suites and can't be
+// negotiated
+var scsvCipherSuites = map[uint16]bool{
+	0x00ff: true, // TLS_EMPTY_RENEGOTIATION_INFO_SCSV
+	0x5600: true, // TLS_FALLBACK_SCSV
+}
+
+// Cipher suites which can only be negotiated in TLS v1.3 (RFC 8446, RFC 8998,
+// RFC 9150 and RFC 9367)
+var tls13CipherSuites = map[uint16]bool{
+	0x1301: true,
+	0x1302: true,
+	0x1303: true,
+	0x1304: true,
+	0x1305: true,
+	0x00c6: true,
+	0x00c7: true,
+	0xc0b4: true,
+	0xc0b5: true,
+	0xc103: true,
+	0xc104: true,
+	0xc105: true,
+	0xc106: true,
+}
+
+// Cipher suites which can be negotiated in both TLS v1.2 and TLS v1.3 (RFC 8492)
+var tls12And13CipherSuites = map[uint16]bool{
+	0xc0b0: true,
+	0xc0b1: true,
+	0xc0b2: true,
+	0xc0b3: true,
+}
+
+// Groups offered in the raw ClientHello, so that the server can pick any
+// elliptic curve or finite field group it supports: x25519, x448, the NIST
+// curves, secp256k1, the brainpool curves and the ffdhe groups
+var rawSupportedGroups = []uint16{29, 30, 23, 24, 25, 21, 22, 26, 27, 28, 256, 257, 258, 259, 260}
+
+// Signature algorithms offered in the raw ClientHello, including the legacy
+// SHA-1 and DSA algorithms
+var rawSignatureAlgorithms = []uint16{
+	0x0403, 0x0503, 0x0603, 0x0203,
+	0x0804, 0x0805, 0x0806, 0x0809, 0x080a, 0x080b,
+	0x0401, 0x0501, 0x0601, 0x0201,
+	0x0807, 0x0808,
+	0x0402, 0x0502, 0x0602, 0x0202,
+}
+
+// Names of the TLS alert descriptions (RFC 8446), used in error messages
+var tlsAlertNames = map[uint8]string{
+	0:   "close notify",
+	10:  "unexpected message",
+	20:  "bad record MAC",
+	22:  "record overflow",
+	40:  "handshake failure",
+	42:  "bad certificate",
+	47:  "illegal parameter",
+	50:  "error decoding message",
+	70:  "protocol version not supported",
+	71:  "insufficient security level",
+	80:  "internal error",
+	86:  "inappropriate fallback",
+	90:  "user canceled",
+	109: "missing extension",
+	110: "unsupported extension",
+	112: "unrecognized name",
+	120: "no application protocol",
+}
+
+// An alert sent by the server instead of a ServerHello
+type tlsAlertError uint8
+
+func (e tlsAlertError) Error() string {
+	if name, ok := tlsAlertNames[uint8(e)]; ok {
+		return "remote error: tls: " + name
+	}
+	return fmt.Sprintf("remote error: tls: alert(%d)", uint8(e))
+}
+
+// The parts of the ServerHello used to determine which protocol version and
+// cipher suite the server selected
+type serverHello struct {
+	Version     uint16
+	CipherSuite uint16
+}
+
+// The result of a raw handshake probe
+type rawHandshakeResult struct {
+	ServerHello   *serverHello
+	LocalAddress  string
+	RemoteAddress string
+}
+
+// Check if the cipher suite can be negotiated in the protocol version, whether
+// or not crypto/tls implements it
+func cipherSuiteIsValid(protocol string, cipher string) bool {
+	// SSL v2 has its own cipher specs
+	if protocol == "SSL v2" {
+		_, ok := constants.SSLv2CipherSpecs[cipher]
+		return ok
+	}
+
+	id, ok := constants.CipherSuites[cipher]
+	if !ok || scsvCipherSuites[id] {
+		return false
+	}
+	switch protocol {
+	case "TLS v1.3":
+		return tls13CipherSuites[id] || tls12And13CipherSuites[id]
+	case "TLS v1.2":
+		return !tls13CipherSuites[id]
+	case "TLS v1.0", "TLS v1.1":
+		// AEAD cipher suites were introduced in TLS v1.2
+		return !tls13CipherSuites[id] && !tls12And13CipherSuites[id] && !isAEADCipherSuite(cipher)
+	case "SSL v3":
+		// Cipher suites defined after TLS v1.0 use extensions, or SHA-2
+		// hashes that SSL v3 doesn't support
+		return id <= 0x00ff && !isAEADCipherSuite(cipher) && !strings.HasSuffix(cipher, "_SHA256") && !strings.HasSuffix(cipher, "_SHA384")
+	}
+	return false
+}
+
+// Check if the cipher suite uses an AEAD cipher, based on its name
+func isAEADCipherSuite(cipher string) bool {
+	for _, mode := range []string{"_GCM", "_CCM", "POLY1305", "_MGM"} {
+		if strings.Contains(cipher, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the ID of the protocol version for a raw handshake probe, which can
+// also be one of the SSL versions
+func rawProtocolVersion(protocol string) uint16 {
+	if version, ok := constants.SSLVersions[protocol]; ok {
+		return version
+	}
+	return constants.TLSVersions[protocol]
+}
+
+// Returns the name of the protocol version from the constants
+func tlsVersionName(version uint16) string {
+	for _, versions := range []map[string]uint16{constants.TLSVersions, constants.SSLVersions} {
+		for name, id := range versions {
+			if id == version {
+				return name
+			}
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// List the names of all cipher suites in the constants, except for signaling
+// cipher suite values
+func allCipherSuiteNames() []string {
+	var names []string
+	for name, id := range constants.CipherSuites {
+		if !scsvCipherSuites[id] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List the names of the SSL v2 cipher specs in the constants
+func sslv2CipherSpecNames() []string {
+	var names []string
+	for name := range constants.SSLv2CipherSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send a hand-built ClientHello offering only the given cipher suite, and read
+// the ServerHello. Unlike crypto/tls, any cipher suite can be offered, since
+// the handshake is abandoned once the server has selected one.
+func probeCipherSuite(ctx context.Context, dialer *proxyDialer, address string, serverName string, version uint16, cipherSuite uint16) (*rawHandshakeResult, error) {
+	hello, err := buildClientHello(version, serverName, []uint16{cipherSuite})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, closeConn, err := dialRawHandshake(ctx, dialer, address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	// The ClientHello is sent in a record with version TLS v1.0, or SSL v3 for
+	// SSL v3 probes, for compatibility with servers which reject newer record
+	// versions
+	recordVersion := min(version, 0x0301)
+	record := []byte{recordTypeHandshake, byte(recordVersion >> 8), byte(recordVersion), byte(len(hello) >> 8), byte(len(hello))}
+	if _, err := conn.Write(append(record, hello...)); err != nil {
+		return nil, err
+	}
+
+	serverHello, err := readServerHello(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return &rawHandshakeResult{
+		ServerHello:   serverHello,
+		LocalAddress:  conn.LocalAddr().String(),
+		RemoteAddress: conn.RemoteAddr().String(),
+	}, nil
+}
+
+// Dial the address for a raw handshake probe. The connection is closed if the
+// context is cancelled, and times out after the dialer timeout. The returned
+// function must be called to close the connection.
+func dialRawHandshake(ctx context.Context, dialer *proxyDialer, address string) (net.Conn, func(), error) {
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	closeConn := func() {
+		stop()
+		conn.Close()
+	}
+
+	timeout := dialer.timeout
+	if timeout <= 0 {
+		timeout = rawHandshakeTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		closeConn()
+		return nil, nil, err
+	}
+
+	return conn, closeConn, nil
+}
+
+// Build a ClientHello handshake message for the protocol version, offering the
+// given cipher suites. The extensions offer every common group and signature
+// algorithm, so that the cipher suite is the only constraint on the server.
+func buildClientHello(version uint16, serverName string, cipherSuites []uint16) ([]byte, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	// TLS v1.3 is negotiated with the supported_versions extension, while the
+	// legacy version field stays at TLS v1.2
+	legacyVersion := version
+	if version > 0x0303 {
+		legacyVersion = 0x0303
+	}
+
+	var keyShare []byte
+	if version >= 0x0304 {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keyShare = key.PublicKey().Bytes()
+	}
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(handshakeTypeClientHello)
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(legacyVersion)
+		b.AddBytes(random)
+		// A session ID is sent for TLS v1.3 middlebox compatibility mode
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			if version >= 0x0304 {
+				sessionID := make([]byte, 32)
+				rand.Read(sessionID)
+				b.AddBytes(sessionID)
+			}
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			for _, suite := range cipherSuites {
+				b.AddUint16(suite)
+			}
+		})
+		// Only the null compression method
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+		})
+		// SSL v3 servers may not support extensions
+		if version < 0x0301 {
+			return
+		}
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			if serverName != "" {
+				addExtension(b, extensionServerName, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(0) // host_name
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes([]byte(serverName))
+						})
+					})
+				})
+			}
+			addExtension(b, extensionSupportedGroups, func(b *cryptobyte.Builder) {
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					for _, group := range rawSupportedGroups {
+						b.AddUint16(group)
+					}
+				})
+			})
+			addExtension(b, extensionECPointFormats, func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddUint8(0) // uncompressed
+				})
+			})
+			if version >= 0x0303 {
+				addExtension(b, extensionSignatureAlgorithms, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						for _, algorithm := range rawSignatureAlgorithms {
+							b.AddUint16(algorithm)
+						}
+					})
+				})
+			}
+			addExtension(b, extensionRenegotiationInfo, func(b *cryptobyte.Builder) {
+				b.AddUint8(0)
+			})
+			if version >= 0x0304 {
+				addExtension(b, extensionSupportedVersions, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(version)
+					})
+				})
+				addExtension(b, extensionPSKKeyExchangeModes, func(b *cryptobyte.Builder) {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint8(1) // psk_dhe_ke
+					})
+				})
+				addExtension(b, extensionKeyShare, func(b *cryptobyte.Builder) {
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddUint16(29) // x25519
+						b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+							b.AddBytes(keyShare)
+						})
+					})
+				})
+			}
+		})
+	})
+	return b.Bytes()
+}
+
+// Add an extension with the given type and data to the ClientHello
+func addExtension(b *cryptobyte.Builder, extensionType uint16, data cryptobyte.BuilderContinuation) {
+	b.AddUint16(extensionType)
+	b.AddUint16LengthPrefixed(data)
+}
+
+// Read TLS records until the ServerHello handshake message is complete, and
+// parse it. An alert from the server is returned as a tlsAlertError.
+func readServerHello(r io.Reader) (*serverHello, error) {
+	var handshake []byte
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("failed to read server response: %v", err)
+		}
+		length := int(header[3])<<8 | int(header[4])
+		if length > 1<<14+2048 {
+			return nil, errors.New("server response is not a TLS record")
+		}
+		fragment := make([]byte, length)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, fmt.Errorf("failed to read server response: %v", err)
+		}
+
+		switch header[0] {
+		case recordTypeAlert:
+			if len(fragment) < 2 {
+				return nil, errors.New("malformed alert from server")
+			}
+			return nil, tlsAlertError(fragment[1])
+		case recordTypeHandshake:
+			handshake = append(handshake, fragment...)
+		default:
+			return nil, fmt.Errorf("unexpected TLS record type %d", header[0])
+		}
+
+		// Wait for the rest of the message if it spans several records
+		if len(handshake) < 4 {
+			continue
+		}
+		if handshake[0] != handshakeTypeServerHello {
+			return nil, fmt.Errorf("unexpected handshake message type %d", handshake[0])
+		}
+		messageLength := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+		if len(handshake) < 4+messageLength {
+			continue
+		}
+		return parseServerHello(handshake[4 : 4+messageLength])
+	}
+}
+
+// Parse the body of a ServerHello message. A HelloRetryRequest has the same
+// format, and also carries the selected cipher suite.
+func parseServerHello(body []byte) (*serverHello, error) {
+	s := cryptobyte.String(body)
+	hello := &serverHello{}
+	var random, sessionID []byte
+	var compression uint8
+	if !s.ReadUint16(&hello.Version) ||
+		!s.ReadBytes(&random, 32) ||
+		!s.ReadUint8LengthPrefixed((*cryptobyte.String)(&sessionID)) ||
+		!s.ReadUint16(&hello.CipherSuite) ||
+		!s.ReadUint8(&compression) {
+		return nil, errors.New("malformed ServerHello")
+	}
+
+	// Extensions are optional before TLS v1.3
+	if s.Empty() {
+		return hello, nil
+	}
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errors.New("malformed ServerHello extensions")
+	}
+	for !extensions.Empty() {
+		var extensionType uint16
+		var data cryptobyte.String
+		if !extensions.ReadUint16(&extensionType) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errors.New("malformed ServerHello extensions")
+		}
+		// The negotiated version of TLS v1.3 is in the supported_versions
+		// extension
+		if extensionType == extensionSupportedVersions && !data.ReadUint16(&hello.Version) {
+			return nil, errors.New("malformed supported_versions extension")
+		}
+	}
+
+	return hello, nil
+}
@@ -0,0 +1,386 @@
+package net
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+var (
+	// SCT list embedded in a certificate, see RFC 6962 section 3.3
+	oidExtensionSCT = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// SCT list in an OCSP single response extension, see RFC 6962 section 3.3
+	oidExtensionOCSPSCT = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+// Sources an SCT can be delivered from
+const (
+	sctSourceEmbedded = "embedded"
+	sctSourceTLS      = "tls"
+	sctSourceOCSP     = "ocsp"
+)
+
+// Entry types of the signed certificate timestamp, see RFC 6962 section 3.1
+const (
+	sctEntryTypeX509    = 0
+	sctEntryTypePrecert = 1
+)
+
+type signedCertificateTimestamp struct {
+	Source            string    `json:"source"`
+	Version           int       `json:"version"`
+	LogID             string    `json:"log_id"`
+	LogDescription    string    `json:"log_description,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`
+	Valid             bool      `json:"valid"`
+	VerificationError string    `json:"verification_error,omitempty"`
+
+	extensions         []byte
+	hashAlgorithm      uint8
+	signatureAlgorithm uint8
+	signature          []byte
+}
+
+// A certificate transparency log, as listed in the log list
+type ctLog struct {
+	Description string
+	PublicKey   crypto.PublicKey
+}
+
+// Format of the log list published by Google, e.g.
+// https://www.gstatic.com/ct/log_list/v3/log_list.json
+type ctLogList struct {
+	Operators []struct {
+		Name string `json:"name"`
+		Logs []struct {
+			Description string `json:"description"`
+			LogID       string `json:"log_id"`
+			Key         string `json:"key"`
+		} `json:"logs"`
+		TiledLogs []struct {
+			Description string `json:"description"`
+			LogID       string `json:"log_id"`
+			Key         string `json:"key"`
+		} `json:"tiled_logs"`
+	} `json:"operators"`
+}
+
+// Returns the certificate transparency logs from the configured log list, keyed
+// by the base64 encoded log ID. Returns nil if no log list is configured.
+func getCTLogs(ctx context.Context, d *plugin.QueryData) (map[string]ctLog, error) {
+	config := GetConfig(d.Connection)
+	if config.CTLogListPath == nil {
+		return nil, nil
+	}
+
+	cacheKey := "getCTLogs"
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(map[string]ctLog), nil
+	}
+
+	content, err := os.ReadFile(*config.CTLogListPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CT log list: %v", err)
+	}
+
+	var logList ctLogList
+	if err := json.Unmarshal(content, &logList); err != nil {
+		return nil, fmt.Errorf("failed to parse CT log list: %v", err)
+	}
+
+	logs := map[string]ctLog{}
+	addLog := func(description string, logID string, key string) {
+		der, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			plugin.Logger(ctx).Warn("getCTLogs", "invalid log key", description, "error", err)
+			return
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			plugin.Logger(ctx).Warn("getCTLogs", "invalid log key", description, "error", err)
+			return
+		}
+		logs[logID] = ctLog{Description: description, PublicKey: publicKey}
+	}
+	for _, operator := range logList.Operators {
+		for _, l := range operator.Logs {
+			addLog(l.Description, l.LogID, l.Key)
+		}
+		for _, l := range operator.TiledLogs {
+			addLog(l.Description, l.LogID, l.Key)
+		}
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, logs); err != nil {
+		plugin.Logger(ctx).Warn("getCTLogs", "failed to cache log list", err)
+	}
+
+	return logs, nil
+}
+
+// Collect the SCTs embedded in the certificate, sent in the TLS handshake and
+// delivered in the stapled OCSP response, and verify them against the logs
+func getCertificateSCTs(ctx context.Context, d *plugin.QueryData, data tableNetCertificateRow) ([]signedCertificateTimestamp, error) {
+	cert := data.rawCert
+	var issuer *x509.Certificate
+	if len(data.Chain) > 0 {
+		issuer = data.Chain[0].rawCert
+	}
+
+	var scts []signedCertificateTimestamp
+
+	// Embedded in the certificate
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionSCT) {
+			continue
+		}
+		list, err := parseSCTListExtension(ext.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse embedded SCTs: %v", err)
+		}
+		scts = append(scts, parseSCTs(list, sctSourceEmbedded)...)
+	}
+
+	// Sent in the TLS handshake
+	scts = append(scts, parseSCTs(data.stapledSCTs, sctSourceTLS)...)
+
+	// Delivered in the stapled OCSP response
+	if len(data.stapledOCSPResponse) > 0 {
+		response, err := ocsp.ParseResponse(data.stapledOCSPResponse, nil)
+		if err != nil {
+			plugin.Logger(ctx).Warn("getCertificateSCTs", "failed to parse stapled OCSP response", err)
+		} else {
+			for _, ext := range response.Extensions {
+				if !ext.Id.Equal(oidExtensionOCSPSCT) {
+					continue
+				}
+				list, err := parseSCTListExtension(ext.Value)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse OCSP SCTs: %v", err)
+				}
+				scts = append(scts, parseSCTs(list, sctSourceOCSP)...)
+			}
+		}
+	}
+
+	logs, err := getCTLogs(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range scts {
+		sct := &scts[i]
+		if sct.VerificationError != "" {
+			continue
+		}
+		if logs == nil {
+			sct.VerificationError = "no CT log list configured"
+			continue
+		}
+		log, ok := logs[sct.LogID]
+		if !ok {
+			sct.VerificationError = "log not found in the CT log list"
+			continue
+		}
+		sct.LogDescription = log.Description
+		if err := verifySCT(sct, log.PublicKey, cert, issuer); err != nil {
+			sct.VerificationError = err.Error()
+			continue
+		}
+		sct.Valid = true
+	}
+
+	return scts, nil
+}
+
+// Decode the SCT list from the value of a certificate or OCSP extension, which
+// wraps the TLS encoded list in an OCTET STRING
+func parseSCTListExtension(value []byte) ([][]byte, error) {
+	var octets []byte
+	if _, err := asn1.Unmarshal(value, &octets); err != nil {
+		return nil, err
+	}
+
+	input := cryptobyte.String(octets)
+	var list cryptobyte.String
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, errors.New("malformed SCT list")
+	}
+
+	var scts [][]byte
+	for !list.Empty() {
+		var sct cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&sct) {
+			return nil, errors.New("malformed SCT list")
+		}
+		scts = append(scts, sct)
+	}
+	return scts, nil
+}
+
+// Parse serialized SCTs, see RFC 6962 section 3.2. SCTs that can't be parsed
+// are returned with a verification error.
+func parseSCTs(serialized [][]byte, source string) []signedCertificateTimestamp {
+	var scts []signedCertificateTimestamp
+	for _, s := range serialized {
+		sct := signedCertificateTimestamp{Source: source}
+
+		input := cryptobyte.String(s)
+		var version uint8
+		var logID []byte
+		var timestamp uint64
+		var extensions, signature cryptobyte.String
+		if !input.ReadUint8(&version) ||
+			!input.ReadBytes(&logID, 32) ||
+			!input.ReadUint64(&timestamp) ||
+			!input.ReadUint16LengthPrefixed(&extensions) ||
+			!input.ReadUint8(&sct.hashAlgorithm) ||
+			!input.ReadUint8(&sct.signatureAlgorithm) ||
+			!input.ReadUint16LengthPrefixed(&signature) {
+			sct.VerificationError = "malformed SCT"
+			scts = append(scts, sct)
+			continue
+		}
+
+		sct.Version = int(version) + 1
+		sct.LogID = base64.StdEncoding.EncodeToString(logID)
+		sct.Timestamp = time.UnixMilli(int64(timestamp)).UTC()
+		sct.extensions = extensions
+		sct.signature = signature
+		scts = append(scts, sct)
+	}
+	return scts
+}
+
+// Verify the SCT signature with the public key of the log
+func verifySCT(sct *signedCertificateTimestamp, publicKey crypto.PublicKey, cert *x509.Certificate, issuer *x509.Certificate) error {
+	if sct.Version != 1 {
+		return fmt.Errorf("unsupported SCT version %d", sct.Version)
+	}
+	// Only SHA-256 is allowed by RFC 6962
+	if sct.hashAlgorithm != 4 {
+		return fmt.Errorf("unsupported SCT hash algorithm %d", sct.hashAlgorithm)
+	}
+
+	// Build the digitally-signed struct, see RFC 6962 section 3.2
+	var b cryptobyte.Builder
+	b.AddUint8(0) // version v1
+	b.AddUint8(0) // signature type certificate_timestamp
+	b.AddUint64(uint64(sct.Timestamp.UnixMilli()))
+	if sct.Source == sctSourceEmbedded {
+		// Embedded SCTs were issued for the precertificate, which is the
+		// certificate without the SCT list extension
+		if issuer == nil {
+			return errors.New("issuer certificate required to verify embedded SCT")
+		}
+		tbs, err := removeSCTExtension(cert.RawTBSCertificate)
+		if err != nil {
+			return err
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		b.AddUint16(sctEntryTypePrecert)
+		b.AddBytes(issuerKeyHash[:])
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(tbs)
+		})
+	} else {
+		b.AddUint16(sctEntryTypeX509)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(cert.Raw)
+		})
+	}
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(sct.extensions)
+	})
+	signed, err := b.Bytes()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signed)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sct.signature) {
+			return errors.New("invalid SCT signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sct.signature); err != nil {
+			return errors.New("invalid SCT signature")
+		}
+	default:
+		return fmt.Errorf("unsupported log key type %T", publicKey)
+	}
+	return nil
+}
+
+// Rebuild the TBSCertificate without the SCT list extension
+func removeSCTExtension(tbs []byte) ([]byte, error) {
+	input := cryptobyte.String(tbs)
+	var fields cryptobyte.String
+	if !input.ReadASN1(&fields, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("malformed TBSCertificate")
+	}
+
+	extensionsTag := cryptobyte_asn1.Tag(3).Constructed().ContextSpecific()
+
+	var b cryptobyte.Builder
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !fields.Empty() {
+			var field cryptobyte.String
+			var tag cryptobyte_asn1.Tag
+			if !fields.ReadAnyASN1Element(&field, &tag) {
+				b.SetError(errors.New("malformed TBSCertificate"))
+				return
+			}
+			if tag != extensionsTag {
+				b.AddBytes(field)
+				continue
+			}
+
+			var wrapper, extensions cryptobyte.String
+			if !field.ReadASN1(&wrapper, extensionsTag) || !wrapper.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+				b.SetError(errors.New("malformed certificate extensions"))
+				return
+			}
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var extension cryptobyte.String
+						if !extensions.ReadASN1Element(&extension, cryptobyte_asn1.SEQUENCE) {
+							b.SetError(errors.New("malformed certificate extension"))
+							return
+						}
+						content := extension
+						var body cryptobyte.String
+						var oid asn1.ObjectIdentifier
+						if !content.ReadASN1(&body, cryptobyte_asn1.SEQUENCE) || !body.ReadASN1ObjectIdentifier(&oid) {
+							b.SetError(errors.New("malformed certificate extension"))
+							return
+						}
+						if oid.Equal(oidExtensionSCT) {
+							continue
+						}
+						b.AddBytes(extension)
+					}
+				})
+			})
+		}
+	})
+	return b.Bytes()
+}
@@ -0,0 +1,314 @@
+package net
+
+import (
+	"bufio"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// A map of protocols supporting an opportunistic TLS upgrade, along with the
+// function used to negotiate the upgrade over the plaintext connection
+var startTLSProtocols = map[string]func(conn net.Conn, host string) error{
+	"ftp":      startTLSFTP,
+	"imap":     startTLSIMAP,
+	"ldap":     startTLSLDAP,
+	"mysql":    startTLSMySQL,
+	"pop3":     startTLSPOP3,
+	"postgres": startTLSPostgres,
+	"smtp":     startTLSSMTP,
+	"xmpp":     startTLSXMPP,
+}
+
+// List all protocols supported by the starttls column
+func startTLSProtocolNames() []string {
+	names := maps.Keys(startTLSProtocols)
+	slices.Sort(names)
+	return names
+}
+
+// Run the plaintext part of the given protocol on the connection, so that it is
+// ready for the TLS handshake
+func startTLS(conn net.Conn, protocol string, host string) error {
+	upgrade, ok := startTLSProtocols[strings.ToLower(protocol)]
+	if !ok {
+		return fmt.Errorf("%s is not a valid starttls protocol. Possible values are: %s", protocol, strings.Join(startTLSProtocolNames(), ", "))
+	}
+	return upgrade(conn, host)
+}
+
+// SMTP (RFC 3207)
+func startTLSSMTP(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("unexpected SMTP greeting: %v", err)
+	}
+	if err := text.PrintfLine("EHLO steampipe"); err != nil {
+		return err
+	}
+	_, msg, err := text.ReadResponse(250)
+	if err != nil {
+		return fmt.Errorf("SMTP EHLO failed: %v", err)
+	}
+	if !strings.Contains(strings.ToUpper(msg), "STARTTLS") {
+		return errors.New("SMTP server does not advertise STARTTLS")
+	}
+	if err := text.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("SMTP STARTTLS failed: %v", err)
+	}
+	return nil
+}
+
+// IMAP (RFC 2595)
+func startTLSIMAP(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.ToUpper(greeting), "* OK") {
+		return fmt.Errorf("unexpected IMAP greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	// Skip any untagged responses until the tagged completion result
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "a001 ") {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(line), "A001 OK") {
+			return fmt.Errorf("IMAP STARTTLS failed: %s", line)
+		}
+		return nil
+	}
+}
+
+// POP3 (RFC 2595)
+func startTLSPOP3(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected POP3 greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("POP3 STLS failed: %s", line)
+	}
+	return nil
+}
+
+// FTP (RFC 4217)
+func startTLSFTP(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("unexpected FTP greeting: %v", err)
+	}
+	if err := text.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(234); err != nil {
+		return fmt.Errorf("FTP AUTH TLS failed: %v", err)
+	}
+	return nil
+}
+
+// LDAP (RFC 4511)
+func startTLSLDAP(conn net.Conn, host string) error {
+	// LDAPMessage with message ID 1 and an ExtendedRequest for the StartTLS OID
+	oid := "1.3.6.1.4.1.1466.20037"
+	request := []byte{0x30, byte(len(oid) + 7), 0x02, 0x01, 0x01, 0x77, byte(len(oid) + 2), 0x80, byte(len(oid))}
+	request = append(request, oid...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	response, err := readBERElement(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("failed to read LDAP StartTLS response: %v", err)
+	}
+
+	var message struct {
+		ID       int
+		Response asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(response, &message); err != nil {
+		return fmt.Errorf("failed to parse LDAP StartTLS response: %v", err)
+	}
+	// ExtendedResponse is [APPLICATION 24], and begins with the LDAPResult fields
+	if message.Response.Class != asn1.ClassApplication || message.Response.Tag != 24 {
+		return errors.New("unexpected LDAP StartTLS response")
+	}
+	var resultCode asn1.Enumerated
+	if _, err := asn1.Unmarshal(message.Response.Bytes, &resultCode); err != nil {
+		return fmt.Errorf("failed to parse LDAP StartTLS result code: %v", err)
+	}
+	if resultCode != 0 {
+		return fmt.Errorf("LDAP StartTLS failed with result code %d", resultCode)
+	}
+	return nil
+}
+
+// Read a single BER encoded element, including its tag and length
+func readBERElement(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 {
+			return nil, errors.New("unsupported BER length")
+		}
+		lengthBytes := make([]byte, size)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxStartTLSResponseSize {
+		return nil, errors.New("response too large")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
+
+// XMPP (RFC 6120)
+func startTLSXMPP(conn net.Conn, host string) error {
+	stream := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", host)
+	if _, err := conn.Write([]byte(stream)); err != nil {
+		return err
+	}
+	features, err := readUntil(conn, "</stream:features>")
+	if err != nil {
+		return fmt.Errorf("failed to read XMPP stream features: %v", err)
+	}
+	if !strings.Contains(features, "urn:ietf:params:xml:ns:xmpp-tls") {
+		return errors.New("XMPP server does not advertise STARTTLS")
+	}
+	if _, err := conn.Write([]byte("<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")); err != nil {
+		return err
+	}
+	response, err := readUntil(conn, ">")
+	if err != nil {
+		return fmt.Errorf("failed to read XMPP STARTTLS response: %v", err)
+	}
+	if !strings.Contains(response, "<proceed") {
+		return fmt.Errorf("XMPP STARTTLS failed: %s", response)
+	}
+	return nil
+}
+
+// Largest response read from the server before the TLS handshake
+const maxStartTLSResponseSize = 64 * 1024
+
+// Read from the connection one byte at a time until the given suffix is seen.
+// Reading byte by byte avoids consuming any of the subsequent TLS handshake.
+func readUntil(conn net.Conn, suffix string) (string, error) {
+	var sb strings.Builder
+	b := make([]byte, 1)
+	for sb.Len() < maxStartTLSResponseSize {
+		if _, err := conn.Read(b); err != nil {
+			return sb.String(), err
+		}
+		sb.WriteByte(b[0])
+		if strings.HasSuffix(sb.String(), suffix) {
+			return sb.String(), nil
+		}
+	}
+	return sb.String(), errors.New("response too large")
+}
+
+// PostgreSQL (SSLRequest message)
+func startTLSPostgres(conn net.Conn, host string) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], 80877103)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+	if response[0] != 'S' {
+		return errors.New("PostgreSQL server does not support SSL")
+	}
+	return nil
+}
+
+// MySQL (SSLRequest packet)
+func startTLSMySQL(conn net.Conn, host string) error {
+	// Read the initial handshake packet sent by the server
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return err
+	}
+	if len(payload) == 0 || payload[0] == 0xff {
+		return errors.New("MySQL server returned an error")
+	}
+	if payload[0] != 10 {
+		return fmt.Errorf("unsupported MySQL protocol version %d", payload[0])
+	}
+
+	// Skip the server version, connection ID and auth plugin data part 1 and
+	// filler to get to the lower capability flags
+	end := slices.Index(payload[1:], 0)
+	offset := 1 + end + 1 + 4 + 8 + 1
+	if end < 0 || len(payload) < offset+2 {
+		return errors.New("malformed MySQL handshake")
+	}
+	const clientSSL = 0x0800
+	capabilities := binary.LittleEndian.Uint16(payload[offset : offset+2])
+	if capabilities&clientSSL == 0 {
+		return errors.New("MySQL server does not support SSL")
+	}
+
+	// SSLRequest: capability flags, max packet size, character set and filler
+	const clientProtocol41 = 0x0200
+	request := make([]byte, 4+32)
+	request[0] = 32
+	request[3] = header[3] + 1
+	binary.LittleEndian.PutUint32(request[4:8], clientProtocol41|clientSSL)
+	binary.LittleEndian.PutUint32(request[8:12], 16777216)
+	request[12] = 33 // utf8_general_ci
+	_, err := conn.Write(request)
+	return err
+}
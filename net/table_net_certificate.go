@@ -1,35 +1,76 @@
 package net
 
 import (
-	"bytes"
 	"context"
-	"crypto/ecdsa"
 	"crypto/rand"
-	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/miekg/dns"
 	"golang.org/x/crypto/ocsp"
+	"golang.org/x/exp/slices"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 )
 
+var oidExtensionNameConstraints = asn1.ObjectIdentifier{2, 5, 29, 30}
+
+// TLS Feature extension (RFC 7633), used to mark a certificate as must-staple
+var oidExtensionTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// The status_request TLS extension, which requests a stapled OCSP response
+const tlsFeatureStatusRequest = 5
+
+// Timeout for connections made to retrieve certificates. Short, certificates
+// should be fast.
+const certificateDialTimeout = time.Duration(3) * time.Second
+
+// Maximum number of names a certificate is searched by in the certificate
+// transparency logs, as each search is rate limited
+const maxCTSearchNames = 2
+
 type OCSP struct {
 	StatusString           string     `json:"status"`
 	RevokedAt              *time.Time `json:"revoked_at,omitempty"`
 	RevocationReasonString string     `json:"revocation_reason,omitempty"`
 }
 
+type revocationInformation struct {
+	Revoked          *bool
+	RevocationStatus string
+	CRLStatus        string
+	CRLError         string
+	OCSP             *OCSP
+	OCSPStatus       string
+	OCSPError        string
+}
+
+type stapledOCSP struct {
+	Stapled           bool
+	Status            string
+	ThisUpdate        *time.Time
+	NextUpdate        *time.Time
+	MustStapleMissing bool
+}
+
 //// TABLE DEFINITION
 
 func tableNetCertificate(ctx context.Context) *plugin.Table {
@@ -37,42 +78,113 @@ func tableNetCertificate(ctx context.Context) *plugin.Table {
 		Name:        "net_certificate",
 		Description: "Certificate details for a domain.",
 		List: &plugin.ListConfig{
-			Hydrate:    tableNetCertificateList,
-			KeyColumns: plugin.AnyColumn([]string{"domain", "address"}),
+			Hydrate: tableNetCertificateList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "domain", Require: plugin.AnyOf},
+				{Name: "address", Require: plugin.AnyOf},
+				{Name: "starttls", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "server_name", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "expected_pins", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "resolve_all", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "client_certificate", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
+			},
 		},
-		Columns: []*plugin.Column{
+		Columns: append([]*plugin.Column{
 			// Top columns
 			{Name: "domain", Type: proto.ColumnType_STRING, Description: "[DEPRECATED] This column has been deprecated and will be removed in a future release, use address instead. Domain name the certificate represents."},
 			{Name: "address", Type: proto.ColumnType_STRING, Description: "Address to connect to, as specified in https://golang.org/pkg/net/#Dial.", Transform: transform.FromQual("address")},
-			{Name: "common_name", Type: proto.ColumnType_STRING, Description: "Common name for the certificate."},
-			{Name: "not_after", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate expires. Also see not_before."},
-			{Name: "revoked", Type: proto.ColumnType_BOOL, Hydrate: getRevocationInformation, Description: "True if the certificate was revoked."},
-			{Name: "transparent", Type: proto.ColumnType_BOOL, Hydrate: getCertificateTransparencyLogs, Transform: transform.FromValue(), Description: "True if the certificate is visible in certificate transparency logs."},
-			{Name: "is_ca", Type: proto.ColumnType_BOOL, Transform: transform.FromField("IsCertificateAuthority"), Description: "True if the certificate represents a certificate authority."},
+			{Name: "starttls", Type: proto.ColumnType_STRING, Description: "Protocol used to upgrade a plaintext connection to TLS before the handshake. Possible values are: ftp, imap, ldap, mysql, pop3, postgres, smtp and xmpp.", Transform: transform.FromQual("starttls")},
+			{Name: "server_name", Type: proto.ColumnType_STRING, Description: "The server name indication sent in the TLS handshake. Defaults to the host of the address. An empty string means no server name indication was sent.", Transform: transform.FromField("ServerName")},
+			{Name: "revoked", Type: proto.ColumnType_BOOL, Hydrate: getRevocationInformation, Transform: transform.FromField("Revoked"), Description: "True if the certificate was revoked. Null if the revocation status could not be checked."},
+			{Name: "revocation_status", Type: proto.ColumnType_STRING, Hydrate: getRevocationInformation, Description: "Revocation status of the certificate, combining the CRL and OCSP checks. Possible values are: good, revoked and unknown, if neither could be checked."},
+			{Name: "transparent", Type: proto.ColumnType_BOOL, Hydrate: getCertificateTransparencyLogs, Transform: transform.FromValue(), Description: "True if the certificate is visible in certificate transparency logs, based on its signed certificate timestamps or a crt.sh lookup."},
+			{Name: "scts", Type: proto.ColumnType_JSON, Hydrate: getSignedCertificateTimestamps, Transform: transform.FromValue(), Description: "Signed certificate timestamps (SCTs) embedded in the certificate, sent in the TLS handshake or delivered in the stapled OCSP response, along with their verification result."},
+			{Name: "chain_valid", Type: proto.ColumnType_BOOL, Hydrate: getCertificateVerification, Transform: transform.FromField("ChainValid"), Description: "True if the certificate chain is trusted by the system roots or the configured CA bundles."},
+			{Name: "hostname_valid", Type: proto.ColumnType_BOOL, Hydrate: getCertificateVerification, Transform: transform.FromField("HostnameValid"), Description: "True if the certificate is valid for the server name, or the host of the address if no server name indication was sent."},
+			{Name: "verification_error", Type: proto.ColumnType_STRING, Hydrate: getCertificateVerification, Description: "Error message if the certificate chain could not be verified."},
+			{Name: "verified_chains", Type: proto.ColumnType_JSON, Hydrate: getCertificateVerification, Description: "List of verified chains, from the certificate to a trusted root, as certificate subjects."},
+			{Name: "dane_records", Type: proto.ColumnType_JSON, Hydrate: getDANEVerification, Transform: transform.FromField("Records"), Description: "TLSA records published for the port and host of the address (e.g. _25._tcp.mail.example.com), with the result of matching each record against the presented certificates."},
+			{Name: "dane_valid", Type: proto.ColumnType_BOOL, Hydrate: getDANEVerification, Transform: transform.FromField("Valid"), Description: "True if any TLSA record matches the presented certificates. Null if no TLSA records are published."},
+			{Name: "dane_dnssec", Type: proto.ColumnType_BOOL, Hydrate: getDANEVerification, Transform: transform.FromField("DNSSEC"), Description: "True if the DNS server reported the TLSA records as authenticated by DNSSEC, which DANE requires to be trusted."},
+			{Name: "caa", Type: proto.ColumnType_JSON, Hydrate: getCAAVerification, Transform: transform.FromField("Checks"), Description: "CAA check for each DNS name of the certificate, with the relevant CAA records found walking up the DNS tree, the CA domains permitted to issue for the name and whether the issuer is one of them."},
+			{Name: "caa_issuer_domain", Type: proto.ColumnType_STRING, Hydrate: getCAAVerification, Transform: transform.FromField("IssuerDomain"), Description: "CAA domain of the certificate authority that issued the certificate, e.g. letsencrypt.org, from the caa_issuer_domains connection config or the defaults. Null if the issuer is not known."},
+			{Name: "caa_compliant", Type: proto.ColumnType_BOOL, Hydrate: getCAAVerification, Transform: transform.FromField("Compliant"), Description: "True if the CAA records of every DNS name of the certificate permit its issuer. Null if the issuer is not known."},
+			{Name: "chain_complete", Type: proto.ColumnType_BOOL, Hydrate: getChainCompleteness, Transform: transform.FromField("ChainComplete"), Description: "True if the presented certificates link the certificate to a trusted root or a self-signed certificate, without fetching missing intermediates."},
+			{Name: "chain_out_of_order", Type: proto.ColumnType_BOOL, Hydrate: getChainCompleteness, Transform: transform.FromField("ChainOutOfOrder"), Description: "True if the presented certificates are not in order, with each certificate followed by its issuer."},
+			{Name: "chain_extra_certificates", Type: proto.ColumnType_JSON, Hydrate: getChainCompleteness, Transform: transform.FromField("ExtraCertificates"), Description: "Presented certificates which are not part of the chain from the certificate, with their position in the presented chain."},
+			{Name: "aia_intermediates", Type: proto.ColumnType_JSON, Hydrate: getChainCompleteness, Transform: transform.FromField("FetchedIntermediates"), Description: "Intermediate certificates missing from the presented chain, fetched from the issuing certificate URLs (authority information access)."},
+			{Name: "aia_chain_complete", Type: proto.ColumnType_BOOL, Hydrate: getChainCompleteness, Transform: transform.FromField("AIAChainComplete"), Description: "True if the chain is complete, either as presented or after fetching the missing intermediates."},
+			{Name: "root_programs", Type: proto.ColumnType_JSON, Hydrate: getTrustAnchor, Transform: transform.FromField("RootPrograms"), Description: "List of root programs which include the trust anchor of the chain, from the net_trusted_root table, e.g. [\"Apple\", \"Mozilla\"]. Membership of these programs requires the trusted_root_snapshot config argument, otherwise roots from the system trust store are listed in a single System program. An empty list means the anchor is not included in any program, e.g. it was removed. Null if the anchor is not a known root, e.g. a private root."},
+			{Name: "trust_anchor", Type: proto.ColumnType_JSON, Hydrate: getTrustAnchor, Transform: transform.FromField("Anchor"), Description: "The root the chain is anchored to, matched by its SPKI in the net_trusted_root table, with its status in each root program."},
+			{Name: "resolve_all", Type: proto.ColumnType_BOOL, Description: "If true, every A and AAAA record of the host is resolved, and a row is returned for each IP address that could be reached.", Transform: transform.FromQual("resolve_all")},
+			{Name: "client_certificate", Type: proto.ColumnType_STRING, Description: "Name of the client certificate profile from the connection config, presented if the server requests a client certificate. Defaults to client_certificate_path, if configured.", Transform: transform.FromQual("client_certificate")},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the connection, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
+			{Name: "client_cert_requested", Type: proto.ColumnType_JSON, Transform: transform.FromField("ClientCertRequested"), Description: "List of acceptable CA names sent by the server when it requested a client certificate. An empty list means any CA is accepted. Null if no client certificate was requested."},
+			{Name: "consistent_leaf", Type: proto.ColumnType_BOOL, Transform: transform.FromField("ConsistentLeaf"), Description: "True if every IP address of the host serves the same leaf certificate, compared by fingerprint_sha256. Null unless resolve_all is true."},
 			// Other columns
-			{Name: "serial_number", Type: proto.ColumnType_STRING, Description: "Serial number of the certificate."},
-			{Name: "subject", Type: proto.ColumnType_STRING, Description: "Subject of the certificate."},
-			{Name: "public_key_algorithm", Type: proto.ColumnType_STRING, Description: "Public key algorithm used by the certificate."},
-			{Name: "public_key_length", Type: proto.ColumnType_INT, Description: "Specifies the size of the key."},
-			{Name: "signature_algorithm", Type: proto.ColumnType_STRING, Description: "Signature algorithm of the certificate."},
+			{Name: "expected_pins", Type: proto.ColumnType_JSON, Transform: transform.FromQual("expected_pins"), Description: "A list of base64 encoded SHA-256 SPKI hashes to check the certificate chain against, e.g. [\"sha256/YLh1dUR9y6Kja30RrAn7JKnbQG/uEtLMkBgFF2Fuihg=\"]."},
+			{Name: "pin_matched", Type: proto.ColumnType_BOOL, Hydrate: getCertificatePinMatch, Transform: transform.FromValue(), Description: "True if any certificate in the chain matches one of the expected pins. Null if no expected_pins were given."},
 			{Name: "ip_address", Type: proto.ColumnType_IPADDR, Transform: transform.FromField("IPAddress"), Description: "IP address associated with the domain."},
-			{Name: "issuer", Type: proto.ColumnType_STRING, Description: "Issuer of the certificate."},
-			{Name: "issuer_name", Type: proto.ColumnType_STRING, Description: "Common name for the issuer of the certificate."},
 			{Name: "chain", Type: proto.ColumnType_JSON, Description: "Certificate chain."},
-			{Name: "country", Type: proto.ColumnType_STRING, Description: "Country for the certificate."},
-			{Name: "dns_names", Type: proto.ColumnType_JSON, Transform: transform.FromField("DNSNames"), Description: "DNS names for the certificate."},
-			{Name: "crl_distribution_points", Type: proto.ColumnType_JSON, Transform: transform.FromField("CRLDistributionPoints"), Description: "A CRL distribution point (CDP) is a location on an LDAP directory server or Web server where a CA publishes CRLs."},
-			{Name: "ocsp_servers", Type: proto.ColumnType_JSON, Transform: transform.FromField("OCSPServers"), Description: "A list of OCSP URLs that are contacted by all end entity certificates to determine revocation status."},
+			{Name: "crl_status", Type: proto.ColumnType_STRING, Hydrate: getRevocationInformation, Transform: transform.FromField("CRLStatus"), Description: "Revocation status of the certificate in its CRL distribution points. Possible values are: good, revoked, unknown, if the certificate has no CRL distribution points, and error."},
+			{Name: "crl_error", Type: proto.ColumnType_STRING, Hydrate: getRevocationInformation, Transform: transform.FromField("CRLError"), Description: "Error message if the CRL could not be checked."},
 			{Name: "ocsp", Type: proto.ColumnType_JSON, Hydrate: getRevocationInformation, Transform: transform.FromField("OCSP"), Description: "Describes OCSP revocation status of the certificate."},
-			{Name: "email_addresses", Type: proto.ColumnType_JSON, Description: "Email addresses for the certificate."},
-			{Name: "ip_addresses", Type: proto.ColumnType_JSON, Transform: transform.FromField("IPAddresses"), Description: "Array of IP addresses associated with the domain."},
-			{Name: "issuing_certificate_url", Type: proto.ColumnType_JSON, Transform: transform.FromField("IssuingCertificateURL"), Description: "List of URLs of the issuing certificates."},
-			{Name: "locality", Type: proto.ColumnType_STRING, Description: "Locality of the certificate."},
-			{Name: "not_before", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate is valid from. Also see not_after."},
-			{Name: "organization", Type: proto.ColumnType_STRING, Description: "Organization of the certificate."},
-			{Name: "ou", Type: proto.ColumnType_JSON, Transform: transform.FromField("OU"), Description: "Organizational Unit of the certificate."},
-			{Name: "state", Type: proto.ColumnType_STRING, Description: "State of the certificate."},
-		},
+			{Name: "ocsp_status", Type: proto.ColumnType_STRING, Hydrate: getRevocationInformation, Transform: transform.FromField("OCSPStatus"), Description: "Revocation status of the certificate from its OCSP responder. Possible values are: good, revoked, unknown, if the certificate has no OCSP server or the issuer is not known, and error."},
+			{Name: "ocsp_error", Type: proto.ColumnType_STRING, Hydrate: getRevocationInformation, Transform: transform.FromField("OCSPError"), Description: "Error message if the OCSP responder could not be checked."},
+			{Name: "ocsp_stapled", Type: proto.ColumnType_BOOL, Hydrate: getStapledOCSPResponse, Transform: transform.FromField("Stapled"), Description: "True if the server stapled an OCSP response to the TLS handshake."},
+			{Name: "ocsp_stapled_status", Type: proto.ColumnType_STRING, Hydrate: getStapledOCSPResponse, Transform: transform.FromField("Status"), Description: "Status of the certificate in the stapled OCSP response. Possible values are: good, revoked, unknown and error, if the response could not be parsed or its signature is invalid."},
+			{Name: "ocsp_stapled_this_update", Type: proto.ColumnType_TIMESTAMP, Hydrate: getStapledOCSPResponse, Transform: transform.FromField("ThisUpdate"), Description: "Time when the status in the stapled OCSP response was known to be correct."},
+			{Name: "ocsp_stapled_next_update", Type: proto.ColumnType_TIMESTAMP, Hydrate: getStapledOCSPResponse, Transform: transform.FromField("NextUpdate"), Description: "Time when newer information about the status will be available from the OCSP responder."},
+			{Name: "must_staple_missing", Type: proto.ColumnType_BOOL, Hydrate: getStapledOCSPResponse, Transform: transform.FromField("MustStapleMissing"), Description: "True if the certificate is must-staple, but the server did not staple an OCSP response."},
+		}, certificateColumns()...),
+	}
+}
+
+// Columns describing a single certificate, shared by net_certificate and the
+// tables that return one row per certificate
+func certificateColumns() []*plugin.Column {
+	return []*plugin.Column{
+		{Name: "common_name", Type: proto.ColumnType_STRING, Description: "Common name for the certificate."},
+		{Name: "not_after", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate expires. Also see not_before."},
+		{Name: "is_ca", Type: proto.ColumnType_BOOL, Transform: transform.FromField("IsCertificateAuthority"), Description: "True if the certificate represents a certificate authority."},
+		{Name: "serial_number", Type: proto.ColumnType_STRING, Description: "Serial number of the certificate."},
+		{Name: "fingerprint_sha1", Type: proto.ColumnType_STRING, Transform: transform.FromField("FingerprintSHA1"), Description: "SHA-1 fingerprint of the DER encoded certificate, as hex."},
+		{Name: "fingerprint_sha256", Type: proto.ColumnType_STRING, Transform: transform.FromField("FingerprintSHA256"), Description: "SHA-256 fingerprint of the DER encoded certificate, as hex."},
+		{Name: "spki_sha256", Type: proto.ColumnType_STRING, Transform: transform.FromField("SPKISHA256"), Description: "Base64 encoded SHA-256 hash of the subject public key info, as used for public key pinning."},
+		{Name: "pem", Type: proto.ColumnType_STRING, Transform: transform.FromField("PEM"), Description: "PEM encoding of the certificate."},
+		{Name: "subject", Type: proto.ColumnType_STRING, Description: "Subject of the certificate."},
+		{Name: "public_key_algorithm", Type: proto.ColumnType_STRING, Description: "Public key algorithm used by the certificate."},
+		{Name: "public_key_length", Type: proto.ColumnType_INT, Description: "Specifies the size of the key."},
+		{Name: "public_key_curve", Type: proto.ColumnType_STRING, Description: "Name of the curve of an elliptic curve key, e.g. P-256, Ed25519 or Ed448."},
+		{Name: "public_key_exponent", Type: proto.ColumnType_INT, Description: "Public exponent of an RSA key, e.g. 65537."},
+		{Name: "weak_key", Type: proto.ColumnType_BOOL, Transform: transform.FromField("WeakKey"), Description: "True if the public key is weak, e.g. a small RSA modulus, an RSA exponent of 1 or 3, or a Debian weak key listed in the configured weak_key_blocklist_paths."},
+		{Name: "weak_key_reasons", Type: proto.ColumnType_JSON, Description: "List of reasons the public key is weak."},
+		{Name: "signature_algorithm", Type: proto.ColumnType_STRING, Description: "Signature algorithm of the certificate."},
+		{Name: "issuer", Type: proto.ColumnType_STRING, Description: "Issuer of the certificate."},
+		{Name: "issuer_name", Type: proto.ColumnType_STRING, Description: "Common name for the issuer of the certificate."},
+		{Name: "country", Type: proto.ColumnType_STRING, Description: "Country for the certificate."},
+		{Name: "dns_names", Type: proto.ColumnType_JSON, Transform: transform.FromField("DNSNames"), Description: "DNS names for the certificate."},
+		{Name: "crl_distribution_points", Type: proto.ColumnType_JSON, Transform: transform.FromField("CRLDistributionPoints"), Description: "A CRL distribution point (CDP) is a location on an LDAP directory server or Web server where a CA publishes CRLs."},
+		{Name: "ocsp_servers", Type: proto.ColumnType_JSON, Transform: transform.FromField("OCSPServers"), Description: "A list of OCSP URLs that are contacted by all end entity certificates to determine revocation status."},
+		{Name: "must_staple", Type: proto.ColumnType_BOOL, Transform: transform.FromField("MustStaple"), Description: "True if the certificate has the TLS Feature extension requiring a stapled OCSP response (OCSP must-staple)."},
+		{Name: "key_usage", Type: proto.ColumnType_JSON, Description: "List of key usages the certificate is valid for, e.g. digitalSignature and keyEncipherment."},
+		{Name: "extended_key_usage", Type: proto.ColumnType_JSON, Description: "List of extended key usages the certificate is valid for, e.g. serverAuth and clientAuth. Unknown usages are listed by OID."},
+		{Name: "policy_identifiers", Type: proto.ColumnType_JSON, Description: "List of certificate policy OIDs."},
+		{Name: "validation_level", Type: proto.ColumnType_STRING, Description: "Validation level derived from the CA/Browser Forum policy OIDs: EV (extended validation), OV (organization validation), IV (individual validation) or DV (domain validation)."},
+		{Name: "basic_constraints_valid", Type: proto.ColumnType_BOOL, Transform: transform.FromField("BasicConstraintsValid"), Description: "True if the certificate has a valid basic constraints extension."},
+		{Name: "max_path_length", Type: proto.ColumnType_INT, Transform: transform.FromField("MaxPathLength"), Description: "Maximum number of intermediate certificates that may follow this certificate in a chain. Null if not constrained."},
+		{Name: "name_constraints", Type: proto.ColumnType_JSON, Description: "Permitted and excluded name subtrees of a certificate authority."},
+		{Name: "subject_key_id", Type: proto.ColumnType_STRING, Transform: transform.FromField("SubjectKeyID"), Description: "Subject key identifier of the certificate, as hex."},
+		{Name: "authority_key_id", Type: proto.ColumnType_STRING, Transform: transform.FromField("AuthorityKeyID"), Description: "Authority key identifier of the certificate, as hex."},
+		{Name: "email_addresses", Type: proto.ColumnType_JSON, Description: "Email addresses for the certificate."},
+		{Name: "ip_addresses", Type: proto.ColumnType_JSON, Transform: transform.FromField("IPAddresses"), Description: "Array of IP addresses associated with the certificate."},
+		{Name: "issuing_certificate_url", Type: proto.ColumnType_JSON, Transform: transform.FromField("IssuingCertificateURL"), Description: "List of URLs of the issuing certificates."},
+		{Name: "locality", Type: proto.ColumnType_STRING, Description: "Locality of the certificate."},
+		{Name: "not_before", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate is valid from. Also see not_after."},
+		{Name: "organization", Type: proto.ColumnType_STRING, Description: "Organization of the certificate."},
+		{Name: "ou", Type: proto.ColumnType_JSON, Transform: transform.FromField("OU"), Description: "Organizational Unit of the certificate."},
+		{Name: "state", Type: proto.ColumnType_STRING, Description: "State of the certificate."},
 	}
 }
 
@@ -81,6 +193,7 @@ func tableNetCertificate(ctx context.Context) *plugin.Table {
 type tableNetCertificateRow struct {
 	// Common
 	Domain     string    `json:"domain,omitempty"`
+	ServerName string    `json:"server_name,omitempty"`
 	CommonName string    `json:"common_name,omitempty"`
 	NotAfter   time.Time `json:"not_after,omitempty"`
 	// Other
@@ -100,19 +213,74 @@ type tableNetCertificateRow struct {
 	OU                     []string                 `json:"ou,omitempty"`
 	PublicKeyAlgorithm     string                   `json:"public_key_algorithm,omitempty"`
 	PublicKeyLength        int                      `json:"public_key_length,omitempty"`
+	PublicKeyCurve         string                   `json:"public_key_curve,omitempty"`
+	PublicKeyExponent      int                      `json:"public_key_exponent,omitempty"`
+	WeakKey                bool                     `json:"weak_key,omitempty"`
+	WeakKeyReasons         []string                 `json:"weak_key_reasons,omitempty"`
 	SignatureAlgorithm     string                   `json:"signature_algorithm,omitempty"`
 	SerialNumber           string                   `json:"serial_number,omitempty"`
+	FingerprintSHA1        string                   `json:"fingerprint_sha1,omitempty"`
+	FingerprintSHA256      string                   `json:"fingerprint_sha256,omitempty"`
+	SPKISHA256             string                   `json:"spki_sha256,omitempty"`
+	PEM                    string                   `json:"pem,omitempty"`
 	State                  string                   `json:"state,omitempty"`
 	Subject                string                   `json:"subject,omitempty"`
 	CRLDistributionPoints  []string                 `json:"crl_distribution_points,omitempty"`
 	OCSPServers            []string                 `json:"ocsp_server,omitempty"`
+	KeyUsage               []string                 `json:"key_usage,omitempty"`
+	ExtendedKeyUsage       []string                 `json:"extended_key_usage,omitempty"`
+	PolicyIdentifiers      []string                 `json:"policy_identifiers,omitempty"`
+	ValidationLevel        string                   `json:"validation_level,omitempty"`
+	BasicConstraintsValid  bool                     `json:"basic_constraints_valid,omitempty"`
+	MaxPathLength          *int                     `json:"max_path_length,omitempty"`
+	NameConstraints        *certNameConstraints     `json:"name_constraints,omitempty"`
+	SubjectKeyID           string                   `json:"subject_key_id,omitempty"`
+	AuthorityKeyID         string                   `json:"authority_key_id,omitempty"`
+	MustStaple             bool                     `json:"must_staple,omitempty"`
+	ConsistentLeaf         *bool                    `json:"-"`
+	ClientCertRequested    []string                 `json:"-"`
+
+	rawCert             *x509.Certificate `json:"-"`
+	stapledSCTs         [][]byte          `json:"-"`
+	stapledOCSPResponse []byte            `json:"-"`
+}
+
+type certificateVerification struct {
+	ChainValid        bool
+	HostnameValid     bool
+	VerificationError string
+	VerifiedChains    [][]string
+}
+
+type trustAnchor struct {
+	RootPrograms []string
+	Anchor       *trustAnchorDetails
+}
 
-	rawCert *x509.Certificate `json:"-"`
+type trustAnchorDetails struct {
+	Subject       string            `json:"subject"`
+	SPKISHA256    string            `json:"spki_sha256"`
+	Owner         string            `json:"owner,omitempty"`
+	ProgramStatus map[string]string `json:"program_status"`
+	Source        string            `json:"source"`
+}
+
+type certNameConstraints struct {
+	Critical                bool     `json:"critical"`
+	PermittedDNSDomains     []string `json:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges,omitempty"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges,omitempty"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses,omitempty"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses,omitempty"`
+	PermittedURIDomains     []string `json:"permitted_uri_domains,omitempty"`
+	ExcludedURIDomains      []string `json:"excluded_uri_domains,omitempty"`
 }
 
 type Cert struct {
 	IssuerCaID     int    `json:"issuer_ca_id"`
 	IssuerName     string `json:"issuer_name"`
+	CommonName     string `json:"common_name"`
 	NameValue      string `json:"name_value"`
 	ID             int64  `json:"id"`
 	EntryTimestamp string `json:"entry_timestamp"`
@@ -127,12 +295,6 @@ func tableNetCertificateList(ctx context.Context, d *plugin.QueryData, h *plugin
 
 	plugin.Logger(ctx).Trace("tableNetCertificateList")
 
-	// Create TLS config
-	cfg := tls.Config{
-		Rand:               rand.Reader,
-		InsecureSkipVerify: true,
-	}
-
 	// Use `address` column first and fall back to `domain` column
 	addr := d.EqualsQualString("address")
 	dn := d.EqualsQualString("domain")
@@ -140,113 +302,253 @@ func tableNetCertificateList(ctx context.Context, d *plugin.QueryData, h *plugin
 		addr = net.JoinHostPort(dn, "443")
 	}
 
-	tcpConnectionCreated := false
-	dialer := &net.Dialer{
-		Timeout: time.Duration(3) * time.Second, // short, certificates should be fast
-		Control: func(network, address string, c syscall.RawConn) error { // This gets called once the TCP connection gets opened before handshake
-			tcpConnectionCreated = true
-			return nil
-		},
+	starttls := d.EqualsQualString("starttls")
+
+	// By default, send the host of the address as server name indication
+	serverNames := getServerNames(d, addr)
+
+	resolveAll := d.EqualsQuals["resolve_all"] != nil && d.EqualsQuals["resolve_all"].GetBoolValue()
+
+	clientCert, err := getClientCertificate(ctx, d, d.EqualsQualString("client_certificate"))
+	if err != nil {
+		return nil, err
 	}
 
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &cfg)
+	dialer, err := getProxyDialer(ctx, d, certificateDialTimeout)
 	if err != nil {
-		if tcpConnectionCreated {
-			plugin.Logger(ctx).Error("net_certificate.tableNetCertificateList", "failed to perform TLS handshake:", err)
+		return nil, err
+	}
+
+	blocklist, err := getWeakKeyBlocklist(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, serverName := range serverNames {
+		if resolveAll {
+			items, err := getCertificateItemsForAllIPs(ctx, dialer, addr, serverName, starttls, clientCert)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				item.Domain = dn
+				blocklist.check(&item)
+				d.StreamListItem(ctx, item)
+			}
+			continue
+		}
+
+		item, err := getCertificateItemForConnection(ctx, dialer, addr, "", serverName, starttls, clientCert)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			continue
+		}
+		item.Domain = dn
+		blocklist.check(item)
+
+		d.StreamListItem(ctx, *item)
+	}
+
+	return nil, nil
+}
+
+// Connect to the address, or the given IP of its host, and build the table row
+// from the certificates presented by the server. Returns nil, if no
+// certificate was found.
+func getCertificateItemForConnection(ctx context.Context, dialer *proxyDialer, addr string, ip string, serverName string, starttls string, clientCert *tls.Certificate) (*tableNetCertificateRow, error) {
+	client := newClientCertificateRequest(clientCert)
+	state, remoteAddr, err := getCertificateConnectionState(ctx, dialer, addr, ip, serverName, starttls, client)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, nil
+	}
+
+	// Should not happen. If it does, then assume the cert was not found.
+	if len(state.PeerCertificates) <= 0 {
+		return nil, nil
+	}
+
+	item, err := getCertificateItem(ctx, state.PeerCertificates, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	item.ServerName = serverName
+	item.stapledSCTs = state.SignedCertificateTimestamps
+	item.stapledOCSPResponse = state.OCSPResponse
+	item.ClientCertRequested = client.requestedCAs()
+
+	return &item, nil
+}
+
+// Resolve every A and AAAA record of the host, and connect to each IP in
+// parallel to build a row per IP. IPs that can't be reached are skipped, so
+// that a single unhealthy node doesn't hide the others.
+func getCertificateItemsForAllIPs(ctx context.Context, dialer *proxyDialer, addr string, serverName string, starttls string, clientCert *tls.Certificate) ([]tableNetCertificateRow, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// Return no rows, if the given host couldn't be found
+		if dnsError, ok := err.(*net.DNSError); ok && dnsError.IsNotFound {
+			plugin.Logger(ctx).Error("net_certificate.getCertificateItemsForAllIPs", "failed to find the host:", err)
 			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to resolve %s: %v", host, err)
+	}
+
+	results := make([]*tableNetCertificateRow, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			item, err := getCertificateItemForConnection(ctx, dialer, addr, ip, serverName, starttls, clientCert)
+			if err != nil {
+				plugin.Logger(ctx).Error("net_certificate.getCertificateItemsForAllIPs", "ip", ip, "error", err)
+				return
+			}
+			results[i] = item
+		}(i, ip.IP.String())
+	}
+	wg.Wait()
+
+	var items []tableNetCertificateRow
+	for _, item := range results {
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+
+	// Compare the leaf certificates served by every node
+	consistentLeaf := true
+	for _, item := range items {
+		if item.FingerprintSHA256 != items[0].FingerprintSHA256 {
+			consistentLeaf = false
+		}
+	}
+	for i := range items {
+		items[i].ConsistentLeaf = &consistentLeaf
+	}
+
+	return items, nil
+}
+
+// Connect to the address and perform a TLS handshake to retrieve the
+// certificates presented by the server. If ip is not empty, it is connected to
+// instead of resolving the host of the address. The given server name is sent
+// as server name indication, unless it is empty. If client is not nil, it
+// handles any client certificate request from the server. The connection is
+// made using the given dialer, which may tunnel it through a proxy. Returns a
+// nil state, if the host couldn't be found or the handshake failed, unless the
+// server requested a client certificate, in which case the state only has the
+// certificates presented by the server.
+func getCertificateConnectionState(ctx context.Context, proxyDialer *proxyDialer, addr string, ip string, serverName string, starttls string, client *clientCertificateRequest) (*tls.ConnectionState, string, error) {
+	// Create TLS config
+	cfg := tls.Config{
+		Rand:               rand.Reader,
+		InsecureSkipVerify: true,
+		ServerName:         serverName,
+	}
+	if client != nil {
+		cfg.GetClientCertificate = client.getClientCertificate
+	}
+
+	// Keep the certificates presented by the server, which in TLS v1.2 are
+	// sent before the client certificate is requested, so that they can be
+	// returned if the server rejects the handshake without a client certificate
+	var peerCertificates []*x509.Certificate
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			if cert, err := x509.ParseCertificate(raw); err == nil {
+				peerCertificates = append(peerCertificates, cert)
+			}
+		}
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "invalid address", err)
+		return nil, "", fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+
+	tcpConnectionCreated := false
+	dialer := *proxyDialer
+	dialer.control = func(network, address string, c syscall.RawConn) error { // This gets called once the TCP connection gets opened before handshake
+		tcpConnectionCreated = true
+		return nil
+	}
+
+	dialAddr := addr
+	if ip != "" {
+		dialAddr = net.JoinHostPort(ip, port)
+	}
+
+	rawConn, err := dialer.DialContext(ctx, "tcp", dialAddr)
+	if err != nil {
 		// Return nil, if the given host couldn't be found
 		if opErr, ok := err.(*net.OpError); ok {
 			if dnsError, isDnsError := opErr.Err.(*net.DNSError); isDnsError {
 				if dnsError.IsNotFound {
-					plugin.Logger(ctx).Error("net_certificate.tableNetCertificateList", "failed to find the host:", err)
-					return nil, nil
+					plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "failed to find the host:", err)
+					return nil, "", nil
 				}
 			}
 		}
-		plugin.Logger(ctx).Error("net_certificate.tableNetCertificateList", "TLS connection failed:", err)
+		plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "TLS connection failed:", err)
 
-		return nil, errors.New("TLS connection failed: " + err.Error())
+		return nil, "", errors.New("TLS connection failed: " + err.Error())
 	}
-	defer conn.Close()
+	defer rawConn.Close()
 
-	items := conn.ConnectionState().PeerCertificates
+	// Limit the time spent on the plaintext upgrade and the TLS handshake
+	if err := rawConn.SetDeadline(time.Now().Add(dialer.timeout)); err != nil {
+		return nil, "", err
+	}
 
-	// Should not happen. If it does, then assume the cert was not found.
-	if len(items) <= 0 {
-		return nil, nil
+	if starttls != "" {
+		if err := startTLS(rawConn, starttls, host); err != nil {
+			plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "starttls failed:", err)
+			return nil, "", fmt.Errorf("%s STARTTLS failed: %v", starttls, err)
+		}
 	}
 
-	chain := items
-	if len(chain) <= 0 {
-		return nil, errors.New("Certificate chain cannot be empty: " + dn)
+	conn := tls.Client(rawConn, &cfg)
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		// The server requested a client certificate and rejected the
+		// handshake, so return the certificates it presented, so that the
+		// request is still reported
+		if client != nil && client.requested && len(peerCertificates) > 0 {
+			plugin.Logger(ctx).Warn("net_certificate.getCertificateConnectionState", "handshake failed after a client certificate was requested:", err)
+			return &tls.ConnectionState{PeerCertificates: peerCertificates}, rawConn.RemoteAddr().String(), nil
+		}
+		if tcpConnectionCreated {
+			plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "failed to perform TLS handshake:", err)
+			return nil, "", nil
+		}
+		plugin.Logger(ctx).Error("net_certificate.getCertificateConnectionState", "TLS connection failed:", err)
+
+		return nil, "", errors.New("TLS connection failed: " + err.Error())
 	}
 
+	state := conn.ConnectionState()
+	return &state, conn.RemoteAddr().String(), nil
+}
+
+// Build the table row from the certificates presented by the server, where
+// the first certificate is the one we've requested
+func getCertificateItem(ctx context.Context, chain []*x509.Certificate, remoteAddr string) (tableNetCertificateRow, error) {
 	certRows := []tableNetCertificateRow{}
 	for _, i := range chain {
-		c := tableNetCertificateRow{}
-
-		// Multiple Subject fields are commonly used, so are elevated to
-		// top level columns.
-		//
-		// In some cases (e.g. Country) multiple items are possible, but very very
-		// rare, so we pull out the first item to the top level for convenience.
-		// The full data is always available in the Subject field that these are
-		// extracted from if needed. We considered making them into a comma separated
-		// string, but decided on the simpler first item model.
-		c.CommonName = i.Subject.CommonName
-		if len(i.Subject.Country) > 0 {
-			c.Country = i.Subject.Country[0]
-		}
-		if len(i.Subject.Province) > 0 {
-			c.State = i.Subject.Province[0]
-		}
-		if len(i.Subject.Locality) > 0 {
-			c.Locality = i.Subject.Locality[0]
-		}
-		if len(i.Subject.Organization) > 0 {
-			c.Organization = i.Subject.Organization[0]
-		}
-		// OU is an array. Naming here is tricky, but ultimately ou feels simple
-		// and common enough to be best. Also considered ous and organizational_unit(s).
-		c.OU = i.Subject.OrganizationalUnit
-
-		c.DNSNames = i.DNSNames
-		c.EmailAddresses = i.EmailAddresses
-		c.IPAddresses = i.IPAddresses
-		c.IsCertificateAuthority = i.IsCA
-		if i.Issuer.CommonName != "" {
-			c.IssuerName = i.Issuer.CommonName
-		} else {
-			if len(i.Issuer.Organization) > 0 && len(i.Issuer.OrganizationalUnit) > 0 {
-				c.IssuerName = fmt.Sprintf("%s / %s", i.Issuer.Organization[0], i.Issuer.OrganizationalUnit[0])
-			}
-		}
-		c.Issuer = i.Issuer.String()
-		c.IssuingCertificateURL = i.IssuingCertificateURL
-		c.NotAfter = i.NotAfter
-		c.NotBefore = i.NotBefore
-		c.PublicKeyAlgorithm = i.PublicKeyAlgorithm.String()
-		// Represent the serial number as 32 hex characters, with leading zeros.
-		// This appears to be consistent with the Qualys SSL display.
-		c.SerialNumber = fmt.Sprintf("%032x", i.SerialNumber)
-		c.SignatureAlgorithm = i.SignatureAlgorithm.String()
-		c.Subject = i.Subject.String()
-		c.CRLDistributionPoints = i.CRLDistributionPoints
-		c.OCSPServers = i.OCSPServer
-
-		var bitLen int
-		switch publicKey := i.PublicKey.(type) {
-		case *rsa.PublicKey:
-			bitLen = publicKey.N.BitLen()
-		case *ecdsa.PublicKey:
-			bitLen = publicKey.Curve.Params().BitSize
-		default:
-		}
-		c.PublicKeyLength = bitLen
-		c.rawCert = i
-
-		certRows = append(certRows, c)
+		certRows = append(certRows, getCertificateRow(i))
 	}
 
 	// The first certificate in the chain is always the one we've requested.
@@ -260,118 +562,623 @@ func tableNetCertificateList(ctx context.Context, d *plugin.QueryData, h *plugin
 
 	// The primary certificate in the request has extra details we can pull
 	// out from the request. Add those now.
-	item.Domain = dn
-	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	host, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
-		plugin.Logger(ctx).Error("net_certificate.tableNetCertificateList", "error retrieving host from network address", err)
-		return nil, fmt.Errorf("failed to extract host from network address: %v", err)
+		plugin.Logger(ctx).Error("net_certificate.getCertificateItem", "error retrieving host from network address", err)
+		return item, fmt.Errorf("failed to extract host from network address: %v", err)
 	}
 	item.IPAddress = host
 
-	d.StreamListItem(ctx, item)
+	return item, nil
+}
 
-	return nil, nil
+// Build the row for a single certificate, with the details that can be
+// extracted from the certificate itself
+func getCertificateRow(i *x509.Certificate) tableNetCertificateRow {
+	c := tableNetCertificateRow{}
+
+	// Multiple Subject fields are commonly used, so are elevated to
+	// top level columns.
+	//
+	// In some cases (e.g. Country) multiple items are possible, but very very
+	// rare, so we pull out the first item to the top level for convenience.
+	// The full data is always available in the Subject field that these are
+	// extracted from if needed. We considered making them into a comma separated
+	// string, but decided on the simpler first item model.
+	c.CommonName = i.Subject.CommonName
+	if len(i.Subject.Country) > 0 {
+		c.Country = i.Subject.Country[0]
+	}
+	if len(i.Subject.Province) > 0 {
+		c.State = i.Subject.Province[0]
+	}
+	if len(i.Subject.Locality) > 0 {
+		c.Locality = i.Subject.Locality[0]
+	}
+	if len(i.Subject.Organization) > 0 {
+		c.Organization = i.Subject.Organization[0]
+	}
+	// OU is an array. Naming here is tricky, but ultimately ou feels simple
+	// and common enough to be best. Also considered ous and organizational_unit(s).
+	c.OU = i.Subject.OrganizationalUnit
+
+	c.DNSNames = i.DNSNames
+	c.EmailAddresses = i.EmailAddresses
+	c.IPAddresses = i.IPAddresses
+	c.IsCertificateAuthority = i.IsCA
+	if i.Issuer.CommonName != "" {
+		c.IssuerName = i.Issuer.CommonName
+	} else {
+		if len(i.Issuer.Organization) > 0 && len(i.Issuer.OrganizationalUnit) > 0 {
+			c.IssuerName = fmt.Sprintf("%s / %s", i.Issuer.Organization[0], i.Issuer.OrganizationalUnit[0])
+		}
+	}
+	c.Issuer = i.Issuer.String()
+	c.IssuingCertificateURL = i.IssuingCertificateURL
+	c.NotAfter = i.NotAfter
+	c.NotBefore = i.NotBefore
+	// Represent the serial number as 32 hex characters, with leading zeros.
+	// This appears to be consistent with the Qualys SSL display.
+	c.SerialNumber = fmt.Sprintf("%032x", i.SerialNumber)
+	c.SignatureAlgorithm = i.SignatureAlgorithm.String()
+	// Fingerprints are calculated over the DER encoding of the certificate,
+	// while pins only cover the public key so they survive a renewal.
+	sha1Sum := sha1.Sum(i.Raw)
+	c.FingerprintSHA1 = hex.EncodeToString(sha1Sum[:])
+	sha256Sum := sha256.Sum256(i.Raw)
+	c.FingerprintSHA256 = hex.EncodeToString(sha256Sum[:])
+	c.SPKISHA256 = getSPKIPin(i)
+	c.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.Raw}))
+	c.Subject = i.Subject.String()
+	c.CRLDistributionPoints = i.CRLDistributionPoints
+	c.OCSPServers = i.OCSPServer
+
+	// Extensions
+	c.KeyUsage = getKeyUsageNames(i.KeyUsage)
+	c.ExtendedKeyUsage = getExtKeyUsageNames(i)
+	for _, oid := range i.PolicyIdentifiers {
+		c.PolicyIdentifiers = append(c.PolicyIdentifiers, oid.String())
+		if level, ok := validationLevelPolicies[oid.String()]; ok {
+			c.ValidationLevel = level
+		}
+	}
+	c.BasicConstraintsValid = i.BasicConstraintsValid
+	// A negative length, or zero without MaxPathLenZero, means the path length
+	// is unconstrained
+	if i.BasicConstraintsValid && (i.MaxPathLen > 0 || i.MaxPathLenZero) {
+		maxPathLen := i.MaxPathLen
+		c.MaxPathLength = &maxPathLen
+	}
+	c.NameConstraints = getNameConstraints(i)
+	c.SubjectKeyID = hex.EncodeToString(i.SubjectKeyId)
+	c.AuthorityKeyID = hex.EncodeToString(i.AuthorityKeyId)
+	c.MustStaple = isMustStaple(i)
+
+	publicKey := getPublicKeyDetails(i)
+	c.PublicKeyAlgorithm = publicKey.Algorithm
+	c.PublicKeyLength = publicKey.Length
+	c.PublicKeyCurve = publicKey.Curve
+	c.PublicKeyExponent = publicKey.Exponent
+	c.WeakKey = len(publicKey.WeakKeyReasons) > 0
+	c.WeakKeyReasons = publicKey.WeakKeyReasons
+	c.rawCert = i
+
+	return c
+}
+
+// Names of the key usages, as defined in RFC 5280
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+// Names of the extended key usages, as defined in RFC 5280 and related RFCs
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "serverAuth",
+	x509.ExtKeyUsageClientAuth:                     "clientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "codeSigning",
+	x509.ExtKeyUsageEmailProtection:                "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:                   "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "microsoftServerGatedCrypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "netscapeServerGatedCrypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "microsoftCommercialCodeSigning",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "microsoftKernelCodeSigning",
+}
+
+// CA/Browser Forum reserved policy OIDs, along with the validation level they
+// represent
+var validationLevelPolicies = map[string]string{
+	"2.23.140.1.1":   "EV",
+	"2.23.140.1.2.1": "DV",
+	"2.23.140.1.2.2": "OV",
+	"2.23.140.1.2.3": "IV",
+}
+
+func getKeyUsageNames(usage x509.KeyUsage) []string {
+	var names []string
+	for _, k := range keyUsageNames {
+		if usage&k.usage != 0 {
+			names = append(names, k.name)
+		}
+	}
+	return names
+}
+
+func getExtKeyUsageNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, usage := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[usage]; ok {
+			names = append(names, name)
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// Returns the name constraints of the certificate, or nil if the certificate
+// has no name constraints extension
+func getNameConstraints(cert *x509.Certificate) *certNameConstraints {
+	hasConstraints := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtensionNameConstraints) {
+			hasConstraints = true
+			break
+		}
+	}
+	if !hasConstraints {
+		return nil
+	}
+
+	ipRanges := func(ranges []*net.IPNet) []string {
+		var values []string
+		for _, r := range ranges {
+			values = append(values, r.String())
+		}
+		return values
+	}
+
+	return &certNameConstraints{
+		Critical:                cert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:     cert.PermittedDNSDomains,
+		ExcludedDNSDomains:      cert.ExcludedDNSDomains,
+		PermittedIPRanges:       ipRanges(cert.PermittedIPRanges),
+		ExcludedIPRanges:        ipRanges(cert.ExcludedIPRanges),
+		PermittedEmailAddresses: cert.PermittedEmailAddresses,
+		ExcludedEmailAddresses:  cert.ExcludedEmailAddresses,
+		PermittedURIDomains:     cert.PermittedURIDomains,
+		ExcludedURIDomains:      cert.ExcludedURIDomains,
+	}
+}
+
+// Checks whether the TLS Feature extension of the certificate requires the
+// status_request extension, i.e. a stapled OCSP response
+func isMustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		return slices.Contains(features, tlsFeatureStatusRequest)
+	}
+	return false
+}
+
+// Returns the base64 encoded SHA-256 hash of the subject public key info, as
+// described in RFC 7469
+func getSPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
 }
 
 //// HYDRATE FUNCTIONS
 
-// Check if certificate is transparent
-func getCertificateTransparencyLogs(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+// Check if any certificate in the chain matches one of the expected pins
+func getCertificatePinMatch(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
 	data := h.Item.(tableNetCertificateRow)
-	domainName := data.CommonName
-	serialNumber := data.SerialNumber
 
-	// crt.sh is a web interface to a distributed database called the certificate transparency logs.
-	// To validate if domain certificate is transparent, check your certificate in certificate transparency logs
-	var certs []Cert
-	baseURL := "https://crt.sh/"
-	url := fmt.Sprintf("%s?identity=%s&exclude=expired&match==&output=json", baseURL, domainName)
+	pinsString := d.EqualsQuals["expected_pins"].GetJsonbValue()
+	if pinsString == "" {
+		return nil, nil
+	}
+
+	var pins []string
+	if err := json.Unmarshal([]byte(pinsString), &pins); err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getCertificatePinMatch", "unmarshal_error", err)
+		return nil, fmt.Errorf("failed to unmarshal expected pins, which must be a list of strings: %v", err)
+	}
+
+	// Pins may be given in the HPKP format, e.g. sha256/<base64 hash>
+	for _, pin := range pins {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == data.SPKISHA256 {
+			return true, nil
+		}
+		for _, c := range data.Chain {
+			if pin == c.SPKISHA256 {
+				return true, nil
+			}
+		}
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	return false, nil
+}
+
+// Verify the certificate chain against the system roots and the configured CA
+// bundles, and check that the certificate is valid for the requested host
+func getCertificateVerification(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+
+	roots, err := getRootCertificatePool(ctx, d)
 	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getCertificateVerification", "root_pool_error", err)
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Intermediates are taken from the chain presented by the server
+	intermediates := x509.NewCertPool()
+	for _, c := range data.Chain {
+		intermediates.AddCert(c.rawCert)
+	}
+
+	verification := certificateVerification{}
+	chains, err := data.rawCert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve certificate transparency log: %v", err)
+		verification.VerificationError = err.Error()
+	} else {
+		verification.ChainValid = true
+		for _, chain := range chains {
+			var subjects []string
+			for _, c := range chain {
+				subjects = append(subjects, c.Subject.String())
+			}
+			verification.VerifiedChains = append(verification.VerifiedChains, subjects)
+		}
 	}
 
-	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
-	if !statusOK {
-		return nil, fmt.Errorf("failed to complete the request for %s: %v.", domainName, resp.Status)
+	// Check the certificate against the name the client asked for, which is the
+	// host of the address if no server name indication was sent
+	hostname := data.ServerName
+	if hostname == "" {
+		addr := d.EqualsQualString("address")
+		if addr == "" {
+			addr = net.JoinHostPort(d.EqualsQualString("domain"), "443")
+		}
+		hostname, _, _ = net.SplitHostPort(addr)
+	}
+	verification.HostnameValid = data.rawCert.VerifyHostname(hostname) == nil
+
+	return verification, nil
+}
+
+// Check if the presented chain is complete and in order, and fetch any missing
+// intermediates from the issuing certificate URLs
+func getChainCompleteness(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+
+	roots, err := getRootCertificatePool(ctx, d)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getChainCompleteness", "root_pool_error", err)
+		return nil, err
+	}
+
+	// Issuing certificate URLs are chosen by the certificate authority, so
+	// bound the time spent fetching from them
+	proxyURL, err := getProxyURL(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: aiaFetchTimeout, Transport: getSharedProxyHTTPTransport(proxyURL)}
+
+	chain := []*x509.Certificate{data.rawCert}
+	for _, c := range data.Chain {
+		chain = append(chain, c.rawCert)
+	}
+
+	return checkChainCompleteness(ctx, d, client, chain, roots), nil
+}
+
+// Find the root the presented chain is anchored to in the trusted roots, along
+// with the root programs that include it
+func getTrustAnchor(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+
+	roots, err := getTrustedRoots(ctx, d)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getTrustAnchor", "trusted_roots_error", err)
+		return nil, err
+	}
+
+	chain := []*x509.Certificate{data.rawCert}
+	for _, c := range data.Chain {
+		chain = append(chain, c.rawCert)
+	}
+
+	result := trustAnchor{}
+	root := roots.findAnchor(chain)
+	if root == nil {
+		return result, nil
+	}
+	result.RootPrograms = root.rootPrograms()
+	result.Anchor = &trustAnchorDetails{
+		Subject:       root.cert.Subject.String(),
+		SPKISHA256:    getSPKIPin(root.cert),
+		Owner:         root.Owner,
+		ProgramStatus: root.ProgramStatus,
+		Source:        root.Source,
+	}
+
+	return result, nil
+}
+
+// Verify the presented certificates against the TLSA records published for the
+// port and host of the address, as described in RFC 6698
+func getDANEVerification(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+
+	addr := d.EqualsQualString("address")
+	if addr == "" {
+		addr = net.JoinHostPort(d.EqualsQualString("domain"), "443")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+
+	// TLSA records are published for host names, not IP addresses
+	if net.ParseIP(host) != nil {
+		return daneVerification{}, nil
+	}
+
+	// Ports can be given by service name, e.g. smtp
+	portNumber, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s: %v", port, err)
+	}
+
+	tlsaName := fmt.Sprintf("_%d._tcp.%s", portNumber, host)
+	records, dnssec, err := lookupTLSA(ctx, d, tlsaName)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getDANEVerification", "tlsa_lookup_error", err)
+		return nil, err
+	}
+
+	verification := daneVerification{DNSSEC: dnssec}
+	if len(records) == 0 {
+		return verification, nil
+	}
+
+	roots, err := getRootCertificatePool(ctx, d)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getDANEVerification", "root_pool_error", err)
+		return nil, err
+	}
+
+	chain := []*x509.Certificate{data.rawCert}
+	for _, c := range data.Chain {
+		chain = append(chain, c.rawCert)
+	}
+
+	// The certificate must be valid for the name the client asked for
+	hostname := data.ServerName
+	if hostname == "" {
+		hostname = host
+	}
+
+	results, valid := verifyDANE(records, chain, roots, hostname)
+	verification.Records = results
+	verification.Valid = &valid
+
+	return verification, nil
+}
+
+// Check whether the issuer of the certificate is permitted by the CAA records of
+// each of its DNS names, as described in RFC 8659
+func getCAAVerification(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+	cert := data.rawCert
+
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" && net.ParseIP(cert.Subject.CommonName) == nil {
+		names = []string{cert.Subject.CommonName}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	client := new(dns.Client)
+	client.Timeout = GetConfigTimeout(ctx, d)
+	dialer, err := getProxyDialer(ctx, d, client.Timeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate transparency log: %v", err)
+		return nil, err
+	}
+	resolver := &caaResolver{
+		client:    client,
+		dialer:    dialer,
+		dnsServer: GetConfigDNSServerAndPort(ctx, d),
+		cache:     map[string][]caaRecord{},
+	}
+
+	verification := caaVerification{IssuerDomain: getCAAIssuerDomain(ctx, d, cert)}
+	compliant := true
+	for _, name := range names {
+		check := resolver.check(ctx, strings.ToLower(name), verification.IssuerDomain)
+		if check.IssuerPermitted == nil || !*check.IssuerPermitted {
+			compliant = false
+		}
+		verification.Checks = append(verification.Checks, check)
+	}
+	if verification.IssuerDomain != "" {
+		verification.Compliant = &compliant
 	}
 
-	err = json.Unmarshal(body, &certs)
+	return verification, nil
+}
+
+// Get the signed certificate timestamps of the certificate
+func getSignedCertificateTimestamps(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+
+	scts, err := getCertificateSCTs(ctx, d, data)
 	if err != nil {
-		plugin.Logger(ctx).Error("net_certificate.getCertificateTransparencyLogs", "unmarshal_error", err)
+		plugin.Logger(ctx).Error("net_certificate.getSignedCertificateTimestamps", "sct_error", err)
 		return nil, err
 	}
+	return scts, nil
+}
+
+// Check if certificate is transparent
+func getCertificateTransparencyLogs(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	data := h.Item.(tableNetCertificateRow)
+	domainName := data.CommonName
+	serialNumber := data.SerialNumber
 
-	// If certificate record found in certificate transparency logs, return transparent as true
-	isTransparent := false
-	for _, c := range certs {
-		if c.SerialNumber == serialNumber {
-			isTransparent = true
+	// A certificate with SCTs has been submitted to certificate transparency
+	// logs. If a log list is configured, at least one SCT must be valid;
+	// otherwise, fall back to searching the logs on crt.sh.
+	scts, err := getCertificateSCTs(ctx, d, data)
+	if err != nil {
+		plugin.Logger(ctx).Warn("net_certificate.getCertificateTransparencyLogs", "sct_error", err)
+	}
+	logListConfigured := GetConfig(d.Connection).CTLogListPath != nil
+	for _, sct := range scts {
+		// Without a log list, a well-formed SCT is taken as proof of logging
+		if sct.Valid || (!logListConfigured && sct.LogID != "") {
+			return true, nil
+		}
+	}
+
+	// crt.sh is a web interface to a distributed database called the certificate transparency logs.
+	// To validate if domain certificate is transparent, check your certificate in certificate transparency logs.
+	// The certificate is searched by its common name and first DNS name, as the
+	// common name is optional and often missing from modern certificates. Any
+	// logged certificate is found by either, so the other names aren't searched.
+	provider, err := getCTProvider(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range append([]string{domainName}, data.DNSNames...) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		if len(names) == maxCTSearchNames {
 			break
 		}
 	}
-	return isTransparent, nil
+
+	// A failed search moves on to the next name, and the error is only
+	// returned if every search failed
+	var lastErr error
+	searched := false
+	for _, name := range names {
+		certs, err := provider.search(ctx, url.Values{
+			"identity": {name},
+			"exclude":  {"expired"},
+			"match":    {"="},
+		})
+		if err != nil {
+			plugin.Logger(ctx).Error("net_certificate.getCertificateTransparencyLogs", "search_error", err)
+			lastErr = err
+			continue
+		}
+		searched = true
+
+		// If certificate record found in certificate transparency logs, return transparent as true
+		for _, c := range certs {
+			if strings.TrimLeft(c.SerialNumber, "0") == strings.TrimLeft(serialNumber, "0") {
+				return true, nil
+			}
+		}
+	}
+	if !searched && lastErr != nil {
+		return nil, lastErr
+	}
+	return false, nil
 }
 
 // Check certificate revocation information
-// This function checks both CRL and OCSP server to check for certificate revocation status
+// This function checks both CRL and OCSP server to check for certificate revocation status.
+// Each source is reported separately as good, revoked, unknown or error, so that
+// an unreachable CRL or OCSP server doesn't hide the result of the other.
 func getRevocationInformation(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
 	plugin.Logger(ctx).Trace("net_certificate.getRevocationInformation")
 
-	certRevocationInfo := map[string]interface{}{}
 	data := h.Item.(tableNetCertificateRow)
+	info := revocationInformation{}
+
+	client, err := getProxyHTTPClient(ctx, d)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check Certificate Revocation List (CRL) to verify certificate revocation status
-	isRevokedByCAOrOwner, err := isCertificateRevokedByCA(ctx, data.CRLDistributionPoints, data.SerialNumber)
+	crlStatus, err := getCRLStatus(ctx, d, client, data)
 	if err != nil {
 		plugin.Logger(ctx).Error("net_certificate.getRevocationInformation", "error getting revocation information from CRL", err)
+		crlStatus = "error"
+		info.CRLError = err.Error()
 	}
+	info.CRLStatus = crlStatus
 
 	// Check Online Certificate Status Protocol (OCSP) to verify certificate revocation status
-	ocspCertificateRevocationInfo, err := fetchOCSPDetails(ctx, data)
-	if err != nil {
+	ocspCertificateRevocationInfo, err := fetchOCSPDetails(ctx, client, data)
+	switch {
+	case err != nil:
 		plugin.Logger(ctx).Error("net_certificate.getRevocationInformation", "error getting revocation information from OCSP server", err)
+		info.OCSPStatus = "error"
+		info.OCSPError = err.Error()
+	case ocspCertificateRevocationInfo == nil:
+		info.OCSPStatus = "unknown"
+	default:
+		info.OCSP = ocspCertificateRevocationInfo
+		info.OCSPStatus = ocspCertificateRevocationInfo.StatusString
 	}
 
-	if ocspCertificateRevocationInfo != nil {
-		certRevocationInfo["OCSP"] = ocspCertificateRevocationInfo
-	}
-
-	if isRevokedByCAOrOwner == nil && ocspCertificateRevocationInfo == nil {
-		return nil, errors.New("failed to retrieve certificate revocation information")
+	// The certificate is revoked if either source says so, and good if it was
+	// checked by at least one source
+	switch {
+	case info.CRLStatus == "revoked" || info.OCSPStatus == "revoked":
+		info.RevocationStatus = "revoked"
+	case info.CRLStatus == "good" || info.OCSPStatus == "good":
+		info.RevocationStatus = "good"
+	default:
+		info.RevocationStatus = "unknown"
 	}
-
-	isRevoked := false
-	if *isRevokedByCAOrOwner || ocspCertificateRevocationInfo.StatusString == "revoked" {
-		isRevoked = true
+	if info.RevocationStatus != "unknown" {
+		isRevoked := info.RevocationStatus == "revoked"
+		info.Revoked = &isRevoked
 	}
-	certRevocationInfo["Revoked"] = isRevoked
 
-	return certRevocationInfo, nil
+	return info, nil
 }
 
 // getOCSPDetails queries the ocsp_server as given in the certificate and fetches the ocsp status
 // adapted from https://github.com/crtsh/ocsp_monitor/blob/e5a2a490acb05dafb0d46f4d0f32c89b1e91a1b5/ocsp_monitor.go#L233
-func fetchOCSPDetails(ctx context.Context, data tableNetCertificateRow) (*OCSP, error) {
+// Returns nil if the certificate has no OCSP server, or its issuer is unknown.
+func fetchOCSPDetails(ctx context.Context, client *http.Client, data tableNetCertificateRow) (*OCSP, error) {
 
 	plugin.Logger(ctx).Trace("net_certificate.fetchOCSPDetails")
 
-	ocspData := OCSP{}
-
 	if len(data.Chain) == 0 {
 		plugin.Logger(ctx).Trace("could not find a certificate chain")
 		return nil, nil
@@ -386,112 +1193,203 @@ func fetchOCSPDetails(ctx context.Context, data tableNetCertificateRow) (*OCSP,
 		return nil, nil
 	}
 
-	for c, requestUrl := range cert.OCSPServer {
-		ocspBytes, err := ocsp.CreateRequest(cert, issuerCert, &ocsp.RequestOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		req, err := http.NewRequest("POST", requestUrl, bytes.NewReader(ocspBytes))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/ocsp-request")
-		req.Header.Set("Connection", "close")
-		req.Header.Set("User-Agent", "Steampipe")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	ocspBytes, err := ocsp.CreateRequest(cert, issuerCert, &ocsp.RequestOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-		body, err := io.ReadAll(resp.Body)
+	var lastErr error
+	for _, requestUrl := range cert.OCSPServer {
+		body, err := sendOCSPRequest(ctx, client, requestUrl, ocspBytes)
 		if err != nil {
 			plugin.Logger(ctx).Error("net_certificate.fetchOCSPDetails", "failed to read OCSP response: ", err)
 
-			// If one URL fails, try other URLs in the list until certificate status is determined or this is the last URL in the list
-			if c+1 == len(cert.OCSPServer) {
-				return nil, fmt.Errorf("failed to read OCSP response: %v", err)
-			}
+			// If one URL fails, try other URLs in the list until certificate status is determined
+			lastErr = fmt.Errorf("failed to read OCSP response from %s: %v", requestUrl, err)
 			continue
 		}
 
 		ocspResponse, err := ocsp.ParseResponseForCert(body, cert, issuerCert)
 		if err != nil {
-			return nil, err
+			lastErr = fmt.Errorf("failed to parse OCSP response from %s: %v", requestUrl, err)
+			continue
 		}
 
-		ocspData = OCSP{}
-		switch ocspResponse.Status {
-		case ocsp.Good:
-			ocspData.StatusString = "good"
-		case ocsp.Unknown:
-			ocspData.StatusString = "unknown"
-		case ocsp.Revoked:
+		ocspData := OCSP{}
+		ocspData.StatusString = getOCSPStatusString(ocspResponse.Status)
+		if ocspResponse.Status == ocsp.Revoked {
 			ocspData.RevokedAt = &ocspResponse.RevokedAt
 			ocspData.RevocationReasonString = getOCSPRevocationReasonString(ocspResponse.RevocationReason)
-			ocspData.StatusString = "revoked"
-		default:
-			ocspData.StatusString = "unexpected"
 		}
 
 		return &ocspData, nil
 	}
 
-	return nil, nil
+	return nil, lastErr
 }
 
-// Checks if the certificate was revoked
-func isCertificateRevokedByCA(ctx context.Context, crlDistributionPoints []string, serialNumber string) (*bool, error) {
-	plugin.Logger(ctx).Trace("isCertificateRevokedByCA")
+// Get the OCSP response stapled by the server during the TLS handshake
+func getStapledOCSPResponse(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("net_certificate.getStapledOCSPResponse")
 
-	isRevoked := false
+	data := h.Item.(tableNetCertificateRow)
+
+	result := stapledOCSP{
+		Stapled:           len(data.stapledOCSPResponse) > 0,
+		MustStapleMissing: data.MustStaple && len(data.stapledOCSPResponse) == 0,
+	}
+	if !result.Stapled {
+		return result, nil
+	}
+
+	// The signature of the response is checked against the issuer, if the
+	// server sent it
+	var issuerCert *x509.Certificate
+	if len(data.Chain) > 0 {
+		issuerCert = data.Chain[0].rawCert
+	}
 
-	for _, crlDistributionPoint := range crlDistributionPoints {
-		crlInfo, err := fetchCRL(crlDistributionPoint)
+	ocspResponse, err := ocsp.ParseResponseForCert(data.stapledOCSPResponse, data.rawCert, issuerCert)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate.getStapledOCSPResponse", "failed to parse stapled OCSP response", err)
+		result.Status = "error"
+		return result, nil
+	}
+
+	result.Status = getOCSPStatusString(ocspResponse.Status)
+	result.ThisUpdate = &ocspResponse.ThisUpdate
+	// A zero NextUpdate means newer information is always available
+	if !ocspResponse.NextUpdate.IsZero() {
+		result.NextUpdate = &ocspResponse.NextUpdate
+	}
+
+	return result, nil
+}
+
+// Checks if the certificate was revoked, according to the CRLs listed in its
+// CRL distribution points. Returns unknown if the certificate has none.
+func getCRLStatus(ctx context.Context, d *plugin.QueryData, client *http.Client, data tableNetCertificateRow) (string, error) {
+	plugin.Logger(ctx).Trace("getCRLStatus")
+
+	if len(data.CRLDistributionPoints) == 0 {
+		return "unknown", nil
+	}
+
+	// The signature of the CRL is checked against the issuer, if the server
+	// sent it
+	var issuerCert *x509.Certificate
+	if len(data.Chain) > 0 {
+		issuerCert = data.Chain[0].rawCert
+	}
+
+	checked := false
+	var lastErr error
+	for _, crlDistributionPoint := range data.CRLDistributionPoints {
+		crlInfo, err := fetchCRL(ctx, d, client, crlDistributionPoint)
 		if err != nil {
-			return nil, err
+			lastErr = fmt.Errorf("failed to fetch CRL from %s: %v", crlDistributionPoint, err)
+			continue
 		}
 
-		// Check CRL is not outdated
-		if crlInfo.NextUpdate.Before(time.Now()) {
-			return nil, errors.New("CRL is outdated")
+		if issuerCert != nil {
+			if err := crlInfo.CheckSignatureFrom(issuerCert); err != nil {
+				lastErr = fmt.Errorf("invalid CRL signature from %s: %v", crlDistributionPoint, err)
+				continue
+			}
+		}
+
+		// Check CRL is not outdated. NextUpdate is optional, and a CRL without
+		// it never becomes outdated.
+		if !crlInfo.NextUpdate.IsZero() && crlInfo.NextUpdate.Before(time.Now()) {
+			lastErr = fmt.Errorf("CRL from %s is outdated", crlDistributionPoint)
+			continue
 		}
 
 		// Check if the certificate is listed in Certificate Revocation List (CRL)
 		for _, i := range crlInfo.RevokedCertificateEntries {
-			if fmt.Sprintf("%032x", i.SerialNumber) == serialNumber {
-				isRevoked = true
-				return &isRevoked, nil
+			if fmt.Sprintf("%032x", i.SerialNumber) == data.SerialNumber {
+				return "revoked", nil
 			}
 		}
+		checked = true
+	}
+
+	if !checked {
+		return "", lastErr
 	}
-	return &isRevoked, nil
+	return "good", nil
 }
 
-// Fetch CRL list
-func fetchCRL(url string) (*x509.RevocationList, error) {
-	resp, err := http.Get(url)
+// Largest CRL downloaded. CRLs of large certificate authorities can be tens of
+// megabytes.
+const maxCRLSize = 64 * 1024 * 1024
+
+// Fetch CRL list. CRLs can be large, so they are cached until their NextUpdate
+// time instead of being fetched again on every query.
+func fetchCRL(ctx context.Context, d *plugin.QueryData, client *http.Client, url string) (*x509.RevocationList, error) {
+	cacheKey := "fetchCRL-" + url
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(*x509.RevocationList), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
-	} else if resp.StatusCode >= 300 {
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
 		return nil, errors.New("failed to retrieve CRL")
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readResponseBody(resp, maxCRLSize)
 	if err != nil {
 		return nil, err
 	}
-	resp.Body.Close()
 
-	parseBody, err := x509.ParseRevocationList(body)
+	parseBody, err := parseCRL(body)
 	if err != nil {
 		return nil, err
 	}
 
+	// A CRL without a NextUpdate time may be replaced at any time, so it is
+	// not cached
+	if ttl := time.Until(parseBody.NextUpdate); ttl > 0 {
+		if err := d.ConnectionCache.SetWithTTL(ctx, cacheKey, parseBody, ttl); err != nil {
+			plugin.Logger(ctx).Warn("fetchCRL", "failed to cache CRL", err)
+		}
+	}
+
 	return parseBody, nil
 }
 
+// Parse a DER or PEM encoded CRL
+func parseCRL(content []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(content); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("unexpected PEM block type %s", block.Type)
+		}
+		content = block.Bytes
+	}
+	return x509.ParseRevocationList(content)
+}
+
+// Parse OCSP certificate status to a human-readable format
+func getOCSPStatusString(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Unknown:
+		return "unknown"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unexpected"
+}
+
 // Parse OCSP revocation status to a human-readable format
 func getOCSPRevocationReasonString(reasonCode int) string {
 	switch reasonCode {
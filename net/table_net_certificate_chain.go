@@ -0,0 +1,127 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"net"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetCertificateChain(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_certificate_chain",
+		Description: "Certificates presented by a server, with one row per certificate in the chain.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetCertificateChainList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "address", Require: plugin.Required},
+				{Name: "starttls", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "server_name", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "client_certificate", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
+			},
+		},
+		Columns: append([]*plugin.Column{
+			// Top columns
+			{Name: "address", Type: proto.ColumnType_STRING, Description: "Address to connect to, as specified in https://golang.org/pkg/net/#Dial.", Transform: transform.FromQual("address")},
+			{Name: "starttls", Type: proto.ColumnType_STRING, Description: "Protocol used to upgrade a plaintext connection to TLS before the handshake. Possible values are: ftp, imap, ldap, mysql, pop3, postgres, smtp and xmpp.", Transform: transform.FromQual("starttls")},
+			{Name: "server_name", Type: proto.ColumnType_STRING, Description: "The server name indication sent in the TLS handshake. Defaults to the host of the address. An empty string means no server name indication was sent.", Transform: transform.FromField("ServerName")},
+			{Name: "client_certificate", Type: proto.ColumnType_STRING, Description: "Name of the client certificate profile from the connection config, presented if the server requests a client certificate. Defaults to client_certificate_path, if configured.", Transform: transform.FromQual("client_certificate")},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the connection, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
+			{Name: "position", Type: proto.ColumnType_INT, Transform: transform.FromField("Position"), Description: "Position of the certificate in the chain presented by the server, where 0 is the leaf certificate."},
+			{Name: "issuer_position", Type: proto.ColumnType_INT, Description: "Position of the presented certificate that issued this certificate. Null if the issuer was not presented by the server."},
+			{Name: "self_signed", Type: proto.ColumnType_BOOL, Transform: transform.FromField("SelfSigned"), Description: "True if the certificate is signed by its own key, e.g. a root certificate."},
+			{Name: "ip_address", Type: proto.ColumnType_IPADDR, Transform: transform.FromField("IPAddress"), Description: "IP address associated with the connection."},
+		}, certificateColumns()...),
+	}
+}
+
+type tableNetCertificateChainRow struct {
+	tableNetCertificateRow
+	Position       int
+	IssuerPosition *int
+	SelfSigned     bool
+}
+
+//// LIST FUNCTION
+
+func tableNetCertificateChainList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetCertificateChainList")
+
+	addr := d.EqualsQualString("address")
+	starttls := d.EqualsQualString("starttls")
+
+	// By default, send the host of the address as server name indication
+	serverNames := getServerNames(d, addr)
+
+	clientCert, err := getClientCertificate(ctx, d, d.EqualsQualString("client_certificate"))
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := getProxyDialer(ctx, d, certificateDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	blocklist, err := getWeakKeyBlocklist(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, serverName := range serverNames {
+		client := newClientCertificateRequest(clientCert)
+		state, remoteAddr, err := getCertificateConnectionState(ctx, dialer, addr, "", serverName, starttls, client)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			plugin.Logger(ctx).Error("net_certificate_chain.tableNetCertificateChainList", "error retrieving host from network address", err)
+			return nil, err
+		}
+
+		chain := state.PeerCertificates
+		for position, cert := range chain {
+			row := tableNetCertificateChainRow{
+				tableNetCertificateRow: getCertificateRow(cert),
+				Position:               position,
+				SelfSigned:             isCertificateIssuedBy(cert, cert),
+			}
+			row.ServerName = serverName
+			row.IPAddress = host
+			blocklist.check(&row.tableNetCertificateRow)
+
+			// Link the certificate to the presented certificate that issued it
+			for issuerPosition, issuer := range chain {
+				if issuerPosition != position && isCertificateIssuedBy(cert, issuer) {
+					row.IssuerPosition = &issuerPosition
+					break
+				}
+			}
+
+			d.StreamListItem(ctx, row)
+		}
+	}
+
+	return nil, nil
+}
+
+// Check if the certificate was issued by the given issuer, i.e. its issuer
+// matches the subject of the issuer and it is signed by the issuer's key
+func isCertificateIssuedBy(cert *x509.Certificate, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	return issuer.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
@@ -0,0 +1,172 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetCertificateFile(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_certificate_file",
+		Description: "Certificate details for certificates stored in local PEM, DER or PKCS#12 files.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetCertificateFileList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "path", Require: plugin.Required},
+				{Name: "password", Require: plugin.Optional, CacheMatch: "exact"},
+			},
+		},
+		Columns: append([]*plugin.Column{
+			// Top columns
+			{Name: "path", Type: proto.ColumnType_STRING, Description: "Path of the certificate file. Paths can be configured with wildcards, e.g., /etc/nginx/certs/*.pem.", Transform: transform.FromQual("path")},
+			{Name: "file_path", Type: proto.ColumnType_STRING, Description: "Path of the file the certificate was read from, when path contains wildcards."},
+			{Name: "position", Type: proto.ColumnType_INT, Transform: transform.FromField("Position"), Description: "Position of the certificate in the file, starting at 0."},
+			{Name: "format", Type: proto.ColumnType_STRING, Description: "Format of the file: PEM, DER or PKCS12."},
+			{Name: "password", Type: proto.ColumnType_STRING, Description: "Password used to decrypt a PKCS#12 file.", Transform: transform.FromQual("password")},
+		}, certificateColumns()...),
+	}
+}
+
+type tableNetCertificateFileRow struct {
+	tableNetCertificateRow
+	FilePath string
+	Position int
+	Format   string
+}
+
+//// LIST FUNCTION
+
+func tableNetCertificateFileList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetCertificateFileList")
+
+	pattern := d.EqualsQualString("path")
+	password := d.EqualsQualString("password")
+
+	blocklist, err := getWeakKeyBlocklist(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_certificate_file.tableNetCertificateFileList", "invalid path pattern", err)
+		return nil, fmt.Errorf("invalid path %s: %v", pattern, err)
+	}
+
+	// A pattern usually matches other files too, e.g. private keys, so those
+	// are skipped rather than failing the query, unless the path names a
+	// single file
+	isPattern := strings.ContainsAny(pattern, `*?[\`)
+
+	for _, path := range paths {
+		if isPattern {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				continue
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if isPattern {
+				plugin.Logger(ctx).Warn("net_certificate_file.tableNetCertificateFileList", "skipping unreadable file", path, "error", err)
+				continue
+			}
+			plugin.Logger(ctx).Error("net_certificate_file.tableNetCertificateFileList", "failed to read file", err)
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		certs, format, err := parseCertificateFile(content, password)
+		if err != nil {
+			if isPattern {
+				plugin.Logger(ctx).Warn("net_certificate_file.tableNetCertificateFileList", "skipping file without certificates", path, "error", err)
+				continue
+			}
+			plugin.Logger(ctx).Error("net_certificate_file.tableNetCertificateFileList", "failed to parse file", err)
+			return nil, fmt.Errorf("failed to parse certificates in %s: %v", path, err)
+		}
+
+		for position, cert := range certs {
+			row := tableNetCertificateFileRow{
+				tableNetCertificateRow: getCertificateRow(cert),
+				FilePath:               path,
+				Position:               position,
+				Format:                 format,
+			}
+			blocklist.check(&row.tableNetCertificateRow)
+			d.StreamListItem(ctx, row)
+
+			// Context can be cancelled due to manual cancellation or the limit has been hit
+			if d.RowsRemaining(ctx) == 0 {
+				return nil, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Parse all certificates from the content of a file, which may be PEM encoded,
+// one or more concatenated DER encoded certificates, or a PKCS#12 archive
+func parseCertificateFile(content []byte, password string) ([]*x509.Certificate, string, error) {
+	if bytes.Contains(content, []byte("-----BEGIN")) {
+		certs, err := parsePEMCertificates(content)
+		return certs, "PEM", err
+	}
+
+	if certs, err := x509.ParseCertificates(content); err == nil {
+		return certs, "DER", nil
+	}
+
+	// A PKCS#12 archive holds either a private key along with its certificate
+	// chain, or only trusted certificates, e.g. a Java trust store
+	_, cert, caCerts, err := pkcs12.DecodeChain(content, password)
+	if err != nil {
+		trusted, trustStoreErr := pkcs12.DecodeTrustStore(content, password)
+		if trustStoreErr != nil {
+			return nil, "", fmt.Errorf("unrecognized format, or failed to decode PKCS#12 file: %v", err)
+		}
+		return trusted, "PKCS12", nil
+	}
+	certs := append([]*x509.Certificate{cert}, caCerts...)
+	return certs, "PKCS12", nil
+}
+
+// Parse all certificate blocks from PEM encoded content, ignoring other blocks
+// such as private keys
+func parsePEMCertificates(content []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
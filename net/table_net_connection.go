@@ -3,10 +3,10 @@ package net
 import (
 	"context"
 	"errors"
-	"net"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 )
 
 func tableNetConnection(ctx context.Context) *plugin.Table {
@@ -18,6 +18,7 @@ func tableNetConnection(ctx context.Context) *plugin.Table {
 			KeyColumns: []*plugin.KeyColumn{
 				{Name: "address"},
 				{Name: "protocol", Require: plugin.Optional},
+				{Name: "proxy", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
 			},
 		},
 		Columns: []*plugin.Column{
@@ -29,6 +30,7 @@ func tableNetConnection(ctx context.Context) *plugin.Table {
 			{Name: "error", Type: proto.ColumnType_STRING, Description: "Error message if the connection failed."},
 			{Name: "local_address", Type: proto.ColumnType_STRING, Description: "Local address (ip:port) for the successful connection."},
 			{Name: "remote_address", Type: proto.ColumnType_STRING, Description: "Remote address (ip:port) for the successful connection."},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the connection, overriding the proxy from the connection config. An empty string connects directly. Only TCP connections can be made through a proxy.", Transform: transform.FromQual("proxy")},
 		},
 	}
 }
@@ -56,12 +58,17 @@ func tableNetConnectionList(ctx context.Context, d *plugin.QueryData, h *plugin.
 	} else {
 		return nil, errors.New("address must be specified")
 	}
-	connectionResult, err := net.DialTimeout(protocol, address, GetConfigTimeout(ctx, d))
+	dialer, err := getProxyDialer(ctx, d, GetConfigTimeout(ctx, d))
+	if err != nil {
+		return nil, err
+	}
+	connectionResult, err := dialer.DialContext(ctx, protocol, address)
 	r := connectionRow{
 		Protocol: protocol,
 		Address:  address,
 	}
 	if err == nil {
+		defer connectionResult.Close()
 		r.Connected = true
 		r.LocalAddress = connectionResult.LocalAddr().String()
 		r.RemoteAddress = connectionResult.RemoteAddr().String()
@@ -0,0 +1,150 @@
+package net
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetCRL(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_crl",
+		Description: "Certificate revocation lists (CRLs) and the certificates revoked by them.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetCRLList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "url", Require: plugin.AnyOf},
+				{Name: "path", Require: plugin.AnyOf},
+				{Name: "issuer_certificate", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
+			},
+		},
+		Columns: []*plugin.Column{
+			// Top columns
+			{Name: "url", Type: proto.ColumnType_STRING, Description: "URL to download the CRL from, e.g. a CRL distribution point of a certificate.", Transform: transform.FromQual("url")},
+			{Name: "path", Type: proto.ColumnType_STRING, Description: "Path of a local DER or PEM encoded CRL file.", Transform: transform.FromQual("path")},
+			{Name: "serial_number", Type: proto.ColumnType_STRING, Description: "Serial number of the revoked certificate. Null if the CRL has no revoked certificates."},
+			{Name: "revocation_time", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate was revoked."},
+			{Name: "revocation_reason", Type: proto.ColumnType_STRING, Description: "Reason the certificate was revoked, e.g. key-compromise or superseded."},
+			// Other columns
+			{Name: "issuer", Type: proto.ColumnType_STRING, Description: "Issuer of the CRL."},
+			{Name: "this_update", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the CRL was issued."},
+			{Name: "next_update", Type: proto.ColumnType_TIMESTAMP, Description: "Time by which the next CRL will be issued."},
+			{Name: "crl_number", Type: proto.ColumnType_STRING, Transform: transform.FromField("CRLNumber"), Description: "Sequence number of the CRL."},
+			{Name: "signature_algorithm", Type: proto.ColumnType_STRING, Description: "Signature algorithm of the CRL."},
+			{Name: "issuer_certificate", Type: proto.ColumnType_STRING, Description: "PEM encoded certificate of the CRL issuer, used to check the signature of the CRL.", Transform: transform.FromQual("issuer_certificate")},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used to download the CRL, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
+			{Name: "signature_valid", Type: proto.ColumnType_BOOL, Transform: transform.FromField("SignatureValid"), Description: "True if the CRL is signed by the issuer_certificate. Null if no issuer_certificate was given."},
+			{Name: "signature_error", Type: proto.ColumnType_STRING, Description: "Error message if the signature of the CRL could not be verified."},
+		},
+	}
+}
+
+type tableNetCRLRow struct {
+	SerialNumber       string
+	RevocationTime     time.Time
+	RevocationReason   string
+	Issuer             string
+	ThisUpdate         time.Time
+	NextUpdate         time.Time
+	CRLNumber          string
+	SignatureAlgorithm string
+	SignatureValid     *bool
+	SignatureError     string
+}
+
+//// LIST FUNCTION
+
+func tableNetCRLList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetCRLList")
+
+	crlURL := d.EqualsQualString("url")
+	path := d.EqualsQualString("path")
+
+	// Download the CRL, or read it from the local file
+	var crl *x509.RevocationList
+	if crlURL != "" {
+		client, err := getProxyHTTPClient(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		list, err := fetchCRL(ctx, d, client, crlURL)
+		if err != nil {
+			plugin.Logger(ctx).Error("net_crl.tableNetCRLList", "failed to fetch CRL", err)
+			return nil, fmt.Errorf("failed to fetch CRL from %s: %v", crlURL, err)
+		}
+		crl = list
+	} else {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			plugin.Logger(ctx).Error("net_crl.tableNetCRLList", "failed to read file", err)
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		list, err := parseCRL(content)
+		if err != nil {
+			plugin.Logger(ctx).Error("net_crl.tableNetCRLList", "failed to parse file", err)
+			return nil, fmt.Errorf("failed to parse CRL in %s: %v", path, err)
+		}
+		crl = list
+	}
+
+	// Details of the CRL itself are repeated on each revoked entry
+	row := tableNetCRLRow{
+		Issuer:             crl.Issuer.String(),
+		ThisUpdate:         crl.ThisUpdate,
+		NextUpdate:         crl.NextUpdate,
+		SignatureAlgorithm: crl.SignatureAlgorithm.String(),
+	}
+	if crl.Number != nil {
+		row.CRLNumber = crl.Number.String()
+	}
+
+	// Check the signature against the issuer, if given
+	if issuerPEM := d.EqualsQualString("issuer_certificate"); issuerPEM != "" {
+		issuers, err := parsePEMCertificates([]byte(issuerPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issuer_certificate: %v", err)
+		}
+		if len(issuers) == 0 {
+			return nil, errors.New("issuer_certificate must contain a PEM encoded certificate")
+		}
+		valid := true
+		if err := crl.CheckSignatureFrom(issuers[0]); err != nil {
+			valid = false
+			row.SignatureError = err.Error()
+		}
+		row.SignatureValid = &valid
+	}
+
+	// Return a single row for an empty CRL, so that its details are still
+	// available
+	if len(crl.RevokedCertificateEntries) == 0 {
+		d.StreamListItem(ctx, row)
+		return nil, nil
+	}
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		item := row
+		// Serial numbers are formatted the same way as in net_certificate
+		item.SerialNumber = fmt.Sprintf("%032x", entry.SerialNumber)
+		item.RevocationTime = entry.RevocationTime
+		item.RevocationReason = getOCSPRevocationReasonString(entry.ReasonCode)
+		d.StreamListItem(ctx, item)
+
+		// Context can be cancelled due to manual cancellation or the limit has been hit
+		if d.RowsRemaining(ctx) == 0 {
+			return nil, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,151 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetCTLogEntry(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_ct_log_entry",
+		Description: "Certificates logged in certificate transparency logs for a domain.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetCTLogEntryList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "domain", Require: plugin.Required},
+				{Name: "match", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
+			},
+		},
+		Columns: []*plugin.Column{
+			// Top columns
+			{Name: "domain", Type: proto.ColumnType_STRING, Description: "Domain name to search for in the certificate transparency logs.", Transform: transform.FromQual("domain")},
+			{Name: "match", Type: proto.ColumnType_STRING, Description: "How the domain is matched: exact (default), subdomain (the domain and all of its subdomains) or wildcard (the domain is a pattern where % or * matches any characters).", Transform: transform.FromField("Match")},
+			{Name: "id", Type: proto.ColumnType_INT, Transform: transform.FromField("ID"), Description: "ID of the certificate in the certificate transparency provider."},
+			{Name: "common_name", Type: proto.ColumnType_STRING, Description: "Common name for the certificate."},
+			{Name: "matched_identities", Type: proto.ColumnType_JSON, Transform: transform.FromField("MatchedIdentities"), Description: "Identities in the certificate that matched the search, e.g. DNS names, the common name or email addresses, as reported by the certificate transparency provider. This is not the full list of DNS names of the certificate."},
+			{Name: "serial_number", Type: proto.ColumnType_STRING, Description: "Serial number of the certificate."},
+			{Name: "not_before", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate is valid from."},
+			{Name: "not_after", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate expires."},
+			// Other columns
+			{Name: "issuer_name", Type: proto.ColumnType_STRING, Description: "Issuer of the certificate."},
+			{Name: "issuer_ca_id", Type: proto.ColumnType_INT, Transform: transform.FromField("IssuerCaID"), Description: "ID of the issuing certificate authority in the certificate transparency provider."},
+			{Name: "entry_timestamp", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate was first seen in a certificate transparency log."},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for requests to the certificate transparency provider, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
+		},
+	}
+}
+
+type tableNetCTLogEntryRow struct {
+	Match             string
+	ID                int64
+	CommonName        string
+	MatchedIdentities []string
+	SerialNumber      string
+	NotBefore         *time.Time
+	NotAfter          *time.Time
+	IssuerName        string
+	IssuerCaID        int
+	EntryTimestamp    *time.Time
+}
+
+//// LIST FUNCTION
+
+func tableNetCTLogEntryList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetCTLogEntryList")
+
+	domain := d.EqualsQualString("domain")
+	match := "exact"
+	if d.EqualsQuals["match"] != nil {
+		match = d.EqualsQualString("match")
+	}
+
+	// Build the searches for the match mode, using crt.sh match semantics
+	var searches []url.Values
+	switch match {
+	case "exact":
+		searches = append(searches, url.Values{"identity": {domain}, "match": {"="}})
+	case "subdomain":
+		searches = append(searches,
+			url.Values{"identity": {domain}, "match": {"="}},
+			url.Values{"identity": {"%." + domain}, "match": {"LIKE"}},
+		)
+	case "wildcard":
+		searches = append(searches, url.Values{"identity": {strings.ReplaceAll(domain, "*", "%")}, "match": {"LIKE"}})
+	default:
+		return nil, fmt.Errorf("%s is not a valid match. Possible values are: exact, subdomain and wildcard", match)
+	}
+
+	provider, err := getCTProvider(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same certificate can be returned by more than one search
+	seen := map[int64]bool{}
+	for _, params := range searches {
+		err := provider.searchEach(ctx, params, func(c Cert) bool {
+			if seen[c.ID] {
+				return true
+			}
+			seen[c.ID] = true
+
+			d.StreamListItem(ctx, getCTLogEntryRow(c, match))
+
+			// Context can be cancelled due to manual cancellation or the limit has been hit
+			return d.RowsRemaining(ctx) != 0
+		})
+		if err != nil {
+			plugin.Logger(ctx).Error("net_ct_log_entry.tableNetCTLogEntryList", "search_error", err)
+			return nil, err
+		}
+		if d.RowsRemaining(ctx) == 0 {
+			return nil, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func getCTLogEntryRow(c Cert, match string) tableNetCTLogEntryRow {
+	row := tableNetCTLogEntryRow{
+		Match:        match,
+		ID:           c.ID,
+		CommonName:   c.CommonName,
+		SerialNumber: c.SerialNumber,
+		IssuerName:   c.IssuerName,
+		IssuerCaID:   c.IssuerCaID,
+	}
+
+	// Matching identities are returned as a newline separated list
+	for _, name := range strings.Split(c.NameValue, "\n") {
+		if name != "" {
+			row.MatchedIdentities = append(row.MatchedIdentities, name)
+		}
+	}
+
+	row.NotBefore = parseCTLogTime(c.NotBefore)
+	row.NotAfter = parseCTLogTime(c.NotAfter)
+	row.EntryTimestamp = parseCTLogTime(c.EntryTimestamp)
+
+	return row
+}
+
+// Parse a time returned by the certificate transparency provider, in UTC
+// without a time zone. Returns nil if the time is missing or malformed.
+func parseCTLogTime(value string) *time.Time {
+	t, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
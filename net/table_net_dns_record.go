@@ -23,12 +23,14 @@ func tableNetDNSRecord(ctx context.Context) *plugin.Table {
 				{Name: "domain", Require: plugin.Required, Operators: []string{"="}},
 				{Name: "type", Require: plugin.Optional, Operators: []string{"="}},
 				{Name: "dns_server", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
 			},
 		},
 		Columns: []*plugin.Column{
 			{Name: "domain", Type: proto.ColumnType_STRING, Description: "Domain name for the record."},
 			{Name: "type", Type: proto.ColumnType_STRING, Description: "Type of the DNS record: A, CNAME, MX, etc."},
 			{Name: "dns_server", Type: proto.ColumnType_STRING, Description: "DNS server name and port used for queries.", Transform: transform.FromQual("dns_server")},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for queries, overriding the proxy from the connection config. Queries are sent over TCP through a proxy. An empty string connects directly.", Transform: transform.FromQual("proxy")},
 			{Name: "ip", Transform: transform.FromField("IP"), Type: proto.ColumnType_IPADDR, Description: "IP address for the record, such as for A records."},
 			{Name: "target", Type: proto.ColumnType_STRING, Description: "Target of the record, such as the target address for CNAME records."},
 			{Name: "priority", Type: proto.ColumnType_INT, Description: "Priority of the record, such as for MX records."},
@@ -64,7 +66,7 @@ type tableDNSRecordRow struct {
 func getTypeQuals(typeQualsWrapper *proto.Quals) []string {
 	if typeQualsWrapper == nil {
 		var allTypes []string
-		return append(allTypes, "A", "AAAA", "CAA", "CERT", "CNAME", "MX", "NS", "PTR", "SOA", "SRV", "TXT")
+		return append(allTypes, "A", "AAAA", "CAA", "CERT", "CNAME", "MX", "NS", "PTR", "SOA", "SRV", "TLSA", "TXT")
 	}
 	var types []string
 	typeQuals := typeQualsWrapper.Quals[0].Value
@@ -100,6 +102,8 @@ func dnsTypeToDNSLibTypeEnum(recordType string) (uint16, error) {
 		return dns.TypeSOA, nil
 	case "SRV":
 		return dns.TypeSRV, nil
+	case "TLSA":
+		return dns.TypeTLSA, nil
 	case "TXT":
 		return dns.TypeTXT, nil
 	}
@@ -187,6 +191,15 @@ func getRecords(domain string, dnsType string, answer dns.RR) []tableDNSRecordRo
 			Target:   typedRecord.Target,
 			TTL:      typedRecord.Hdr.Ttl,
 		})
+	case *dns.TLSA:
+		// Certificate usage, selector, matching type and certificate
+		// association data, e.g. 3 1 1 0b9fa5a5...
+		records = append(records, tableDNSRecordRow{
+			Domain: domain,
+			Type:   dnsType,
+			TTL:    typedRecord.Hdr.Ttl,
+			Value:  fmt.Sprintf("%d %d %d %s", typedRecord.Usage, typedRecord.Selector, typedRecord.MatchingType, typedRecord.Certificate),
+		})
 	case *dns.TXT:
 		for _, txt := range typedRecord.Txt {
 			records = append(records, tableDNSRecordRow{
@@ -232,6 +245,11 @@ func tableDNSRecordList(ctx context.Context, d *plugin.QueryData, h *plugin.Hydr
 		dnsServer = GetConfigDNSServerAndPort(ctx, d)
 	}
 
+	dialer, err := getProxyDialer(ctx, d, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
 	logger.Debug("tableDNSRecordList", "Cols", queryCols)
 	logger.Debug("tableDNSRecordList", "Domain", domain)
 	logger.Debug("tableDNSRecordList", "Types", types)
@@ -249,12 +267,7 @@ func tableDNSRecordList(ctx context.Context, d *plugin.QueryData, h *plugin.Hydr
 			m.SetQuestion(dns.Fqdn(domain), dnsTypeEnumVal)
 			m.RecursionDesired = true
 
-			co, err := c.Dial(dnsServer)
-			if err != nil {
-				return nil, fmt.Errorf("unable to connect to the address: %v", err)
-			}
-
-			r, _, err := c.ExchangeWithConn(m, co)
+			r, err := exchangeDNS(ctx, c, dialer, dnsServer, m)
 			if err != nil {
 				return nil, err
 			}
@@ -290,3 +303,29 @@ func tableDNSRecordList(ctx context.Context, d *plugin.QueryData, h *plugin.Hydr
 
 	return nil, nil
 }
+
+// Send the query to the DNS server, using a new connection made by
+// dialDNSServer
+func exchangeDNS(ctx context.Context, c *dns.Client, dialer *proxyDialer, dnsServer string, m *dns.Msg) (*dns.Msg, error) {
+	co, err := dialDNSServer(ctx, c, dialer, dnsServer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the address: %v", err)
+	}
+	defer co.Close()
+
+	r, _, err := c.ExchangeWithConn(m, co)
+	return r, err
+}
+
+// Connect to the DNS server. Queries can only be tunnelled over TCP, so if the
+// dialer uses a proxy, the connection is made over TCP through the proxy.
+func dialDNSServer(ctx context.Context, c *dns.Client, dialer *proxyDialer, dnsServer string) (*dns.Conn, error) {
+	if dialer.proxy == nil {
+		return c.Dial(dnsServer)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", dnsServer)
+	if err != nil {
+		return nil, err
+	}
+	return &dns.Conn{Conn: conn}, nil
+}
@@ -2,8 +2,11 @@ package net
 
 import (
 	"context"
+	"fmt"
 	"net"
 
+	"github.com/miekg/dns"
+
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,14 +17,18 @@ func tableNetDNSReverse(ctx context.Context) *plugin.Table {
 		Name:        "net_dns_reverse",
 		Description: "Reverse DNS lookup from an IP address.",
 		List: &plugin.ListConfig{
-			Hydrate:    tableNetDNSReverseList,
-			KeyColumns: plugin.SingleColumn("ip_address"),
+			Hydrate: tableNetDNSReverseList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "ip_address", Require: plugin.Required, Operators: []string{"="}},
+				{Name: "proxy", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
+			},
 		},
 		Columns: []*plugin.Column{
 			// Top columns
 			{Name: "ip_address", Type: proto.ColumnType_IPADDR, Transform: transform.FromField("IPAddress"), Description: "IP address to lookup."},
 			// Other columns
 			{Name: "domains", Type: proto.ColumnType_JSON, Description: "Domain names associated with the IP address."},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the lookup, overriding the proxy from the connection config. Through a proxy, the lookup is sent over TCP to the DNS server from the connection config instead of the system resolver. An empty string connects directly.", Transform: transform.FromQual("proxy")},
 		},
 	}
 }
@@ -38,6 +45,21 @@ func tableNetDNSReverseList(ctx context.Context, d *plugin.QueryData, h *plugin.
 		IPAddress: ip,
 		Domains:   []string{},
 	}
+
+	dialer, err := getProxyDialer(ctx, d, GetConfigTimeout(ctx, d))
+	if err != nil {
+		return nil, err
+	}
+	if dialer.proxy != nil {
+		domains, err := lookupAddrWithDialer(ctx, d, dialer, ip)
+		if err != nil {
+			return nil, err
+		}
+		result.Domains = domains
+		d.StreamListItem(ctx, result)
+		return nil, nil
+	}
+
 	domains, err := net.LookupAddr(ip)
 	if err != nil {
 		if e, ok := err.(*net.DNSError); ok {
@@ -51,3 +73,36 @@ func tableNetDNSReverseList(ctx context.Context, d *plugin.QueryData, h *plugin.
 	d.StreamListItem(ctx, result)
 	return nil, nil
 }
+
+// Lookup the PTR records of the IP address by querying the DNS server from the
+// connection config through the dialer
+func lookupAddrWithDialer(ctx context.Context, d *plugin.QueryData, dialer *proxyDialer, ip string) ([]string, error) {
+	reverseName, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &dns.Client{Net: "tcp", Timeout: GetConfigTimeout(ctx, d)}
+	m := new(dns.Msg)
+	m.SetQuestion(reverseName, dns.TypePTR)
+	m.RecursionDesired = true
+	r, err := exchangeDNS(ctx, c, dialer, GetConfigDNSServerAndPort(ctx, d), m)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	if r.Rcode != dns.RcodeSuccess {
+		// No domains, if the address has no PTR records
+		if r.Rcode == dns.RcodeNameError {
+			return domains, nil
+		}
+		return nil, fmt.Errorf("reverse lookup of %s failed: %s", ip, dns.RcodeToString[r.Rcode])
+	}
+	for _, answer := range r.Answer {
+		if ptr, ok := answer.(*dns.PTR); ok {
+			domains = append(domains, ptr.Ptr)
+		}
+	}
+	return domains, nil
+}
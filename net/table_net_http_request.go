@@ -3,6 +3,7 @@ package net
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -28,6 +29,8 @@ func tableNetHTTPRequest() *plugin.Table {
 				{Name: "follow_redirects", Require: plugin.Optional, Operators: []string{"=", "<>"}, CacheMatch: "exact"},
 				{Name: "request_headers", Require: plugin.Optional, CacheMatch: "exact"},
 				{Name: "request_body", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "client_certificate", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
 			},
 		},
 		Columns: []*plugin.Column{
@@ -36,6 +39,8 @@ func tableNetHTTPRequest() *plugin.Table {
 			{Name: "follow_redirects", Type: proto.ColumnType_BOOL, Description: "If true, the requests will follow the redirects."},
 			{Name: "request_body", Type: proto.ColumnType_STRING, Description: "The request's body."},
 			{Name: "request_headers", Type: proto.ColumnType_JSON, Transform: transform.FromQual("request_headers"), Description: "A map of headers passed in the request."},
+			{Name: "client_certificate", Type: proto.ColumnType_STRING, Description: "Name of the client certificate profile from the connection config, presented if the server requests a client certificate. Defaults to client_certificate_path, if configured.", Transform: transform.FromQual("client_certificate")},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the request, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
 			{Name: "response_status_code", Type: proto.ColumnType_INT, Description: "HTTP status code is a server response to a browser's request."},
 			{Name: "response_body", Type: proto.ColumnType_STRING, Description: "Represents the response body."},
 			{Name: "response_error", Type: proto.ColumnType_STRING, Description: "Represents an error or failure, either from a non-successful HTTP status, an error while executing the request, or some other failure which occurred during the parsing of the response.", Transform: transform.FromField("Error")},
@@ -119,6 +124,34 @@ func listRequestResponses(ctx context.Context, d *plugin.QueryData, h *plugin.Hy
 		}
 	}
 
+	// Present the client certificate for mutual TLS, if configured
+	clientCert, err := getClientCertificate(ctx, d, d.EqualsQualString("client_certificate"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the request through the proxy, if configured
+	proxyURL, err := getProxyURL(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientCert != nil {
+		// The client certificate comes from the connection config, so the
+		// transport isn't shared with other queries, and its idle connections
+		// are closed once the requests are done
+		transport := getProxyHTTPTransport(proxyURL)
+		transport.TLSClientConfig = &tls.Config{
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return clientCert, nil
+			},
+		}
+		defer transport.CloseIdleConnections()
+		client.Transport = transport
+	} else {
+		client.Transport = getSharedProxyHTTPTransport(proxyURL)
+	}
+
 	if !followRedirects {
 		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
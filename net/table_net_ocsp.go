@@ -0,0 +1,245 @@
+package net
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetOCSP(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_ocsp",
+		Description: "Online Certificate Status Protocol (OCSP) responses for a certificate.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetOCSPList,
+			KeyColumns: plugin.KeyColumnSlice{
+				{Name: "certificate", Require: plugin.AnyOf},
+				{Name: "address", Require: plugin.AnyOf},
+				{Name: "issuer_certificate", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "responder_url", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "send_nonce", Require: plugin.Optional, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, CacheMatch: "exact"},
+			},
+		},
+		Columns: []*plugin.Column{
+			// Top columns
+			{Name: "certificate", Type: proto.ColumnType_STRING, Description: "PEM encoded certificate to check. If it is followed by its issuer certificate, the issuer is used to build the request.", Transform: transform.FromQual("certificate")},
+			{Name: "address", Type: proto.ColumnType_STRING, Description: "Address to retrieve the certificate from, as specified in https://golang.org/pkg/net/#Dial.", Transform: transform.FromQual("address")},
+			{Name: "responder_url", Type: proto.ColumnType_STRING, Transform: transform.FromField("ResponderURL"), Description: "URL of the OCSP responder the request was sent to. Defaults to the first OCSP server of the certificate."},
+			{Name: "status", Type: proto.ColumnType_STRING, Description: "Status of the certificate in the OCSP response. Possible values are: good, revoked and unknown."},
+			{Name: "revoked_at", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate was revoked."},
+			{Name: "revocation_reason", Type: proto.ColumnType_STRING, Description: "Reason the certificate was revoked, e.g. key-compromise or superseded."},
+			{Name: "produced_at", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the OCSP response was signed."},
+			{Name: "this_update", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the status in the response was known to be correct."},
+			{Name: "next_update", Type: proto.ColumnType_TIMESTAMP, Description: "Time when newer information about the status will be available. Null if newer information is always available."},
+			// Other columns
+			{Name: "issuer_certificate", Type: proto.ColumnType_STRING, Description: "PEM encoded certificate of the issuer. Defaults to the issuer following the certificate, or presented by the server at address.", Transform: transform.FromQual("issuer_certificate")},
+			{Name: "serial_number", Type: proto.ColumnType_STRING, Description: "Serial number of the certificate in the OCSP response."},
+			{Name: "response_status", Type: proto.ColumnType_STRING, Description: "Status of the OCSP response, e.g. success, malformed or unauthorized."},
+			{Name: "responder_id", Type: proto.ColumnType_STRING, Transform: transform.FromField("ResponderID"), Description: "Identifier of the responder that signed the response, either its subject or the hex encoded SHA-1 hash of its public key."},
+			{Name: "responder_certificate", Type: proto.ColumnType_STRING, Description: "Subject of the delegated responder certificate included in the response, if any."},
+			{Name: "signature_algorithm", Type: proto.ColumnType_STRING, Description: "Signature algorithm of the OCSP response."},
+			{Name: "signature_valid", Type: proto.ColumnType_BOOL, Transform: transform.FromField("SignatureValid"), Description: "True if the response is signed by the issuer, or by a responder certificate issued by the issuer."},
+			{Name: "signature_error", Type: proto.ColumnType_STRING, Description: "Error message if the signature of the response could not be verified."},
+			{Name: "send_nonce", Type: proto.ColumnType_BOOL, Transform: transform.FromField("SendNonce"), Description: "If true (default), a random nonce is sent in the request to protect against replayed responses."},
+			{Name: "request_nonce", Type: proto.ColumnType_STRING, Description: "Hex encoded nonce sent in the request."},
+			{Name: "response_nonce", Type: proto.ColumnType_STRING, Description: "Hex encoded nonce returned in the response. Null if the responder does not support nonces, e.g. because it serves pre-signed responses."},
+			{Name: "nonce_matched", Type: proto.ColumnType_BOOL, Transform: transform.FromField("NonceMatched"), Description: "True if the response nonce matches the request nonce. Null if no nonce was sent."},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the connection and the OCSP request, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
+		},
+	}
+}
+
+type tableNetOCSPRow struct {
+	ResponderURL         string
+	Status               string
+	RevokedAt            time.Time
+	RevocationReason     string
+	ProducedAt           time.Time
+	ThisUpdate           time.Time
+	NextUpdate           time.Time
+	SerialNumber         string
+	ResponseStatus       string
+	ResponderID          string
+	ResponderCertificate string
+	SignatureAlgorithm   string
+	SignatureValid       bool
+	SignatureError       string
+	SendNonce            bool
+	RequestNonce         string
+	ResponseNonce        *string
+	NonceMatched         *bool
+}
+
+//// LIST FUNCTION
+
+func tableNetOCSPList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetOCSPList")
+
+	// Get the certificate to check, along with any certificates following it
+	var chain []*x509.Certificate
+	if certPEM := d.EqualsQualString("certificate"); certPEM != "" {
+		certs, err := parsePEMCertificates([]byte(certPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		chain = certs
+	} else {
+		addr := d.EqualsQualString("address")
+		dialer, err := getProxyDialer(ctx, d, certificateDialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		state, _, err := getCertificateConnectionState(ctx, dialer, addr, "", defaultServerName(addr), "", nil)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			return nil, nil
+		}
+		chain = state.PeerCertificates
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("certificate must contain a PEM encoded certificate")
+	}
+	cert := chain[0]
+
+	// Use the given issuer, or the one following the certificate
+	var issuer *x509.Certificate
+	if issuerPEM := d.EqualsQualString("issuer_certificate"); issuerPEM != "" {
+		issuers, err := parsePEMCertificates([]byte(issuerPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issuer_certificate: %v", err)
+		}
+		if len(issuers) > 0 {
+			issuer = issuers[0]
+		}
+	} else if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	if issuer == nil {
+		return nil, errors.New("issuer_certificate is required when the issuer is not available from the certificate or address")
+	}
+
+	row := tableNetOCSPRow{SendNonce: true}
+	if d.EqualsQuals["send_nonce"] != nil {
+		row.SendNonce = d.EqualsQuals["send_nonce"].GetBoolValue()
+	}
+
+	row.ResponderURL = d.EqualsQualString("responder_url")
+	if row.ResponderURL == "" {
+		if len(cert.OCSPServer) == 0 {
+			return nil, errors.New("certificate has no OCSP server, responder_url is required")
+		}
+		row.ResponderURL = cert.OCSPServer[0]
+	}
+
+	var nonce []byte
+	if row.SendNonce {
+		var err error
+		nonce, err = newOCSPNonce()
+		if err != nil {
+			return nil, err
+		}
+		row.RequestNonce = hex.EncodeToString(nonce)
+	}
+
+	request, err := createOCSPRequest(cert, issuer, nonce)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_ocsp.tableNetOCSPList", "failed to create OCSP request", err)
+		return nil, fmt.Errorf("failed to create OCSP request: %v", err)
+	}
+
+	client, err := getProxyHTTPClient(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sendOCSPRequest(ctx, client, row.ResponderURL, request)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_ocsp.tableNetOCSPList", "failed to send OCSP request", err)
+		return nil, fmt.Errorf("failed to send OCSP request to %s: %v", row.ResponderURL, err)
+	}
+
+	// Parse without checking the signature first, so that an invalid
+	// signature can be reported alongside the rest of the response
+	response, err := parseOCSPResponseUnverified(body, cert)
+	if err != nil {
+		// Unsuccessful responses have no other details
+		var responseErr ocsp.ResponseError
+		if errors.As(err, &responseErr) {
+			row.ResponseStatus = responseErr.Status.String()
+			d.StreamListItem(ctx, row)
+			return nil, nil
+		}
+		plugin.Logger(ctx).Error("net_ocsp.tableNetOCSPList", "failed to parse OCSP response", err)
+		return nil, fmt.Errorf("failed to parse OCSP response: %v", err)
+	}
+
+	row.ResponseStatus = ocsp.Success.String()
+	row.Status = getOCSPStatusString(response.Status)
+	if response.Status == ocsp.Revoked {
+		row.RevokedAt = response.RevokedAt
+		row.RevocationReason = getOCSPRevocationReasonString(response.RevocationReason)
+	}
+	row.ProducedAt = response.ProducedAt
+	row.ThisUpdate = response.ThisUpdate
+	row.NextUpdate = response.NextUpdate
+	if response.SerialNumber != nil {
+		row.SerialNumber = fmt.Sprintf("%032x", response.SerialNumber)
+	}
+	row.ResponderID = getOCSPResponderID(response)
+	if response.Certificate != nil {
+		row.ResponderCertificate = response.Certificate.Subject.String()
+	}
+	row.SignatureAlgorithm = response.SignatureAlgorithm.String()
+
+	if _, err := ocsp.ParseResponseForCert(body, cert, issuer); err != nil {
+		row.SignatureError = err.Error()
+	} else {
+		row.SignatureValid = true
+	}
+
+	if row.SendNonce {
+		responseNonce, err := getOCSPResponseNonce(response)
+		if err != nil {
+			plugin.Logger(ctx).Error("net_ocsp.tableNetOCSPList", "failed to parse OCSP response nonce", err)
+			return nil, err
+		}
+		matched := false
+		if responseNonce != nil {
+			nonce := hex.EncodeToString(responseNonce)
+			row.ResponseNonce = &nonce
+			matched = nonce == row.RequestNonce
+		}
+		row.NonceMatched = &matched
+	}
+
+	d.StreamListItem(ctx, row)
+
+	return nil, nil
+}
+
+// Get the responder ID as the subject of the responder, or the hex encoded
+// hash of its public key
+func getOCSPResponderID(response *ocsp.Response) string {
+	if len(response.RawResponderName) > 0 {
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(response.RawResponderName, &name); err == nil {
+			return name.String()
+		}
+	}
+	return hex.EncodeToString(response.ResponderKeyHash)
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"fmt"
-	"net"
 	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/turbot/steampipe-plugin-net/constants"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
@@ -26,33 +29,46 @@ func tableNetTLSConnection(ctx context.Context) *plugin.Table {
 				{Name: "address", Require: plugin.Required, Operators: []string{"="}},
 				{Name: "version", Require: plugin.Optional, Operators: []string{"="}},
 				{Name: "cipher_suite_name", Require: plugin.Optional, Operators: []string{"="}},
+				{Name: "server_name", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
+				{Name: "client_certificate", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
+				{Name: "proxy", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
+				{Name: "all_cipher_suites", Require: plugin.Optional, Operators: []string{"="}, CacheMatch: "exact"},
 			},
 		},
 		Columns: []*plugin.Column{
 			{Name: "address", Type: proto.ColumnType_STRING, Description: "Address to connect to, as specified in https://golang.org/pkg/net/#Dial.", Transform: transform.FromQual("address")},
-			{Name: "server_name", Type: proto.ColumnType_STRING, Description: "The server name indication extension sent by the client."},
-			{Name: "version", Type: proto.ColumnType_STRING, Description: "The TLS version used by the connection."},
+			{Name: "server_name", Type: proto.ColumnType_STRING, Description: "The server name indication extension sent by the client. Defaults to the host of the address. An empty string means no server name indication was sent.", Transform: transform.FromField("ServerName")},
+			{Name: "version", Type: proto.ColumnType_STRING, Description: "The protocol version used by the connection. Possible values are: TLS v1.3, TLS v1.2, TLS v1.1, TLS v1.0, SSL v3 and SSL v2."},
 			{Name: "cipher_suite_name", Type: proto.ColumnType_STRING, Description: "The cipher suite negotiated for the connection."},
 			{Name: "cipher_suite_id", Type: proto.ColumnType_STRING, Description: "The ID of the cipher suite."},
 			{Name: "handshake_completed", Type: proto.ColumnType_BOOL, Description: "True if the handshake was successful."},
+			{Name: "accepted", Type: proto.ColumnType_BOOL, Transform: transform.FromField("Accepted"), Description: "True if the server accepted the protocol version and cipher suite, either completing the handshake or selecting them in its ServerHello."},
+			{Name: "raw_probe", Type: proto.ColumnType_BOOL, Transform: transform.FromField("RawProbe"), Description: "True if the cipher suite is not implemented by the Go TLS package, so support was checked by sending a hand-built ClientHello and reading the ServerHello, without completing the handshake."},
+			{Name: "all_cipher_suites", Type: proto.ColumnType_BOOL, Description: "If true, every known cipher suite is checked, including those the Go TLS package doesn't implement, instead of only those it implements. SSL v2 cipher specs are always checked. Defaults to false.", Transform: transform.FromQual("all_cipher_suites")},
 			{Name: "error", Type: proto.ColumnType_STRING, Description: "Error message if the connection failed."},
 			{Name: "fallback_scsv_supported", Type: proto.ColumnType_BOOL, Description: "True if the TLS fallback SCSV is enabled to prevent protocol downgrade attacks.", Hydrate: checkFallbackSCSVSupport, Transform: transform.FromValue()},
 			{Name: "alpn_supported", Type: proto.ColumnType_BOOL, Description: "True if the ALPN is supported.", Hydrate: checkAPLNSupport, Transform: transform.FromValue()},
+			{Name: "client_certificate", Type: proto.ColumnType_STRING, Description: "Name of the client certificate profile from the connection config, presented if the server requests a client certificate. Defaults to client_certificate_path, if configured.", Transform: transform.FromQual("client_certificate")},
+			{Name: "client_cert_requested", Type: proto.ColumnType_JSON, Description: "List of acceptable CA names sent by the server when it requested a client certificate. An empty list means any CA is accepted. Null if no client certificate was requested."},
 			{Name: "local_address", Type: proto.ColumnType_STRING, Description: "Local address (ip:port) for the successful connection."},
 			{Name: "remote_address", Type: proto.ColumnType_STRING, Description: "Remote address (ip:port) for the successful connection."},
+			{Name: "proxy", Type: proto.ColumnType_STRING, Description: "Proxy URL used for the connection, overriding the proxy from the connection config. An empty string connects directly.", Transform: transform.FromQual("proxy")},
 		},
 	}
 }
 
 type tlsConnectionRow struct {
-	Version            string `json:"version"`
-	CipherSuiteName    string `json:"cipher_suite_name"`
-	CipherSuiteID      string `json:"cipher_suite_id"`
-	ServerName         string `json:"server_name"`
-	HandshakeCompleted bool   `json:"handshake_completed"`
-	Error              string `json:"error"`
-	LocalAddress       string `json:"local_address"`
-	RemoteAddress      string `json:"remote_address"`
+	Version             string   `json:"version"`
+	CipherSuiteName     string   `json:"cipher_suite_name"`
+	CipherSuiteID       string   `json:"cipher_suite_id"`
+	ServerName          string   `json:"server_name"`
+	HandshakeCompleted  bool     `json:"handshake_completed"`
+	Accepted            bool     `json:"accepted"`
+	RawProbe            bool     `json:"raw_probe"`
+	Error               string   `json:"error"`
+	LocalAddress        string   `json:"local_address"`
+	RemoteAddress       string   `json:"remote_address"`
+	ClientCertRequested []string `json:"client_cert_requested"`
 }
 
 //// LIST FUNCTION
@@ -64,48 +80,181 @@ func tableNetTLSConnectionList(ctx context.Context, d *plugin.QueryData, h *plug
 	quals := d.EqualsQuals
 	address := d.EqualsQualString("address")
 
-	// By default, consider all available protocols and ciphers
+	// By default, consider all available protocols, and the ciphers supported
+	// by crypto/tls. Every known cipher is only considered if all_cipher_suites
+	// is true, as it needs many more handshakes. SSL v2 has its own cipher
+	// specs, which are all checked with a single handshake.
 	var ciphers []string
 	for _, c := range cipherSuites() {
 		ciphers = append(ciphers, c.Name)
 	}
-	protocols := []string{"TLS v1.3", "TLS v1.2", "TLS v1.1", "TLS v1.0"}
+	if d.EqualsQuals["all_cipher_suites"] != nil && d.EqualsQuals["all_cipher_suites"].GetBoolValue() {
+		ciphers = allCipherSuiteNames()
+	}
+	sslv2Ciphers := sslv2CipherSpecNames()
+	protocols := []string{"TLS v1.3", "TLS v1.2", "TLS v1.1", "TLS v1.0", "SSL v3", "SSL v2"}
 
 	// Check for additional quals
+	if d.EqualsQuals["cipher_suite_name"] != nil {
+		ciphers = getQualListValues(ctx, quals, "cipher_suite_name")
+		sslv2Ciphers = ciphers
+	}
 	if d.EqualsQuals["version"] != nil {
 		protocols = getQualListValues(ctx, quals, "version")
 	}
-	if d.EqualsQuals["cipher_suite_name"] != nil {
-		ciphers = getQualListValues(ctx, quals, "cipher_suite_name")
+
+	// By default, send the host of the address as server name indication
+	serverNames := getServerNames(d, address)
+
+	clientCert, err := getClientCertificate(ctx, d, d.EqualsQualString("client_certificate"))
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := getProxyDialer(ctx, d, 0)
+	if err != nil {
+		return nil, err
 	}
 
+	limiter, err := getHandshakeLimiter(ctx, d, address)
+	if err != nil {
+		return nil, err
+	}
+
+	type tlsConnectionJob struct {
+		serverName string
+		protocol   string
+		ciphers    []string
+	}
+
+	// Scan the combinations with a bounded pool of workers, rather than
+	// starting every handshake at once, which can be mistaken for an attack
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan tlsConnectionJob)
 	var wg sync.WaitGroup
-	for _, protocol := range protocols {
-		for _, cipher := range ciphers {
-			wg.Add(1)
-			go func(p string, c string) {
-				row := getTLSConnectionRowData(ctx, address, p, c)
-				d.StreamListItem(ctx, row)
+	for i := 0; i < getMaxConcurrency(d); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				var ok bool
+				if job.protocol == "SSL v2" {
+					ok = scanSSLv2Connection(ctx, d, limiter, dialer, address, job.serverName, job.ciphers)
+				} else {
+					ok = scanTLSConnection(ctx, d, limiter, dialer, address, job.serverName, job.protocol, job.ciphers[0], clientCert)
+				}
+				if !ok {
+					// Stop the other workers, and the remaining jobs
+					cancel()
+					return
+				}
+			}
+		}()
+	}
 
-				wg.Done()
-			}(protocol, cipher)
+jobLoop:
+	for _, serverName := range serverNames {
+		for _, protocol := range protocols {
+			// The SSL v2 SERVER-HELLO lists every offered cipher spec the
+			// server supports, so a single handshake checks all of them
+			if protocol == "SSL v2" {
+				select {
+				case jobs <- tlsConnectionJob{serverName, protocol, sslv2Ciphers}:
+				case <-ctx.Done():
+					break jobLoop
+				}
+				continue
+			}
+			for _, cipher := range ciphers {
+				select {
+				case jobs <- tlsConnectionJob{serverName, protocol, []string{cipher}}:
+				case <-ctx.Done():
+					break jobLoop
+				}
+			}
 		}
 	}
+	close(jobs)
 	wg.Wait()
 
 	return nil, nil
 }
 
-func getTLSConnectionRowData(ctx context.Context, address string, protocol string, cipher string) tlsConnectionRow {
+// Handshake with the server using a single protocol and cipher suite, and
+// stream the result. Returns false if the scan should stop, because the context
+// was cancelled or the limit has been hit.
+func scanTLSConnection(ctx context.Context, d *plugin.QueryData, limiter *handshakeLimiter, dialer *proxyDialer, address string, serverName string, protocol string, cipher string, clientCert *tls.Certificate) bool {
+	// Combinations which are not valid are reported without a handshake
+	handshake := cipherSuiteIsValid(protocol, cipher)
+	return streamTLSConnectionRows(ctx, d, limiter, handshake, func() []tlsConnectionRow {
+		return []tlsConnectionRow{getTLSConnectionRowData(ctx, dialer, address, serverName, protocol, cipher, clientCert)}
+	})
+}
+
+// Probe SSL v2 with a single handshake offering all the valid cipher specs,
+// and stream a result for each cipher. Returns false if the scan should stop.
+func scanSSLv2Connection(ctx context.Context, d *plugin.QueryData, limiter *handshakeLimiter, dialer *proxyDialer, address string, serverName string, ciphers []string) bool {
+	handshake := slices.ContainsFunc(ciphers, func(cipher string) bool {
+		return cipherSuiteIsValid("SSL v2", cipher)
+	})
+	return streamTLSConnectionRows(ctx, d, limiter, handshake, func() []tlsConnectionRow {
+		return getSSLv2ConnectionRowData(ctx, dialer, address, serverName, ciphers)
+	})
+}
+
+// Run the probe within the handshake limits, if it makes a handshake, and
+// stream the resulting rows. Returns false if the scan should stop, because
+// the context was cancelled or the limit has been hit.
+func streamTLSConnectionRows(ctx context.Context, d *plugin.QueryData, limiter *handshakeLimiter, handshake bool, probe func() []tlsConnectionRow) bool {
+	if handshake {
+		if err := limiter.wait(ctx); err != nil {
+			return false
+		}
+	}
+
+	rows := probe()
+	// Handshakes interrupted by the cancellation would be reported as failed
+	stop := ctx.Err() != nil
+	for _, row := range rows {
+		if stop {
+			break
+		}
+		d.StreamListItem(ctx, row)
+
+		// Context can be cancelled due to manual cancellation or the limit has been hit
+		stop = d.RowsRemaining(ctx) == 0
+	}
+
+	if handshake {
+		if stop {
+			limiter.release()
+			return false
+		}
+		return limiter.done(ctx) == nil
+	}
+	return !stop
+}
+
+func getTLSConnectionRowData(ctx context.Context, dialer *proxyDialer, address string, serverName string, protocol string, cipher string, clientCert *tls.Certificate) tlsConnectionRow {
 	r := tlsConnectionRow{
 		Version:         protocol,
 		CipherSuiteName: cipher,
 		CipherSuiteID:   fmt.Sprintf("0x%04x", constants.CipherSuites[cipher]),
+		ServerName:      serverName,
+	}
+	if spec, ok := constants.SSLv2CipherSpecs[cipher]; ok {
+		r.CipherSuiteID = fmt.Sprintf("0x%06x", spec)
 	}
 
-	if cipherSuiteIsSupported(protocol, cipher) {
-		conn, err := getTLSConnection(ctx, address, protocol, cipher)
+	switch {
+	case cipherSuiteIsValid(protocol, cipher) && cipherSuiteIsSupported(protocol, cipher):
+		client := newClientCertificateRequest(clientCert)
+		conn, err := getTLSConnection(ctx, dialer, address, serverName, protocol, cipher, client)
+		r.ClientCertRequested = client.requestedCAs()
 		if err == nil && conn != nil {
+			defer conn.Close()
+
 			// Fetch the negotiated cipher suite from the connection state
 			state := conn.ConnectionState()
 			negotiatedCipherID := state.CipherSuite
@@ -115,25 +264,99 @@ func getTLSConnectionRowData(ctx context.Context, address string, protocol strin
 			r.CipherSuiteName = negotiatedCipherName
 			r.CipherSuiteID = fmt.Sprintf("0x%04x", negotiatedCipherID)
 
-			r.ServerName = state.ServerName
 			r.HandshakeCompleted = state.HandshakeComplete
+			r.Accepted = state.HandshakeComplete
 			r.LocalAddress = conn.LocalAddr().String()
 			r.RemoteAddress = conn.RemoteAddr().String()
 		} else {
 			r.Error = err.Error()
 		}
-	} else {
+	case cipherSuiteIsValid(protocol, cipher):
+		// crypto/tls doesn't implement the cipher suite or protocol version, so
+		// check whether the server selects it in response to a hand-built
+		// ClientHello
+		r.RawProbe = true
+		version := rawProtocolVersion(protocol)
+		result, err := probeCipherSuite(ctx, dialer, address, serverName, version, constants.CipherSuites[cipher])
+		if err != nil {
+			r.Error = err.Error()
+			break
+		}
+		hello := result.ServerHello
+		r.LocalAddress = result.LocalAddress
+		r.RemoteAddress = result.RemoteAddress
+		switch {
+		case hello.Version != version:
+			r.Error = fmt.Sprintf("server negotiated %s instead", tlsVersionName(hello.Version))
+		case hello.CipherSuite != constants.CipherSuites[cipher]:
+			r.Error = fmt.Sprintf("server selected cipher suite 0x%04x, which was not offered", hello.CipherSuite)
+		default:
+			r.Accepted = true
+		}
+	default:
 		r.Error = "unsupported protocol-cipher combination"
 	}
 
 	return r
 }
 
+// Handshake with the server using SSL v2, offering the valid cipher specs, and
+// return a row for each cipher. SSL v2 has a different handshake, and the
+// server lists the offered cipher specs it supports.
+func getSSLv2ConnectionRowData(ctx context.Context, dialer *proxyDialer, address string, serverName string, ciphers []string) []tlsConnectionRow {
+	var specs []uint32
+	for _, cipher := range ciphers {
+		if cipherSuiteIsValid("SSL v2", cipher) {
+			specs = append(specs, constants.SSLv2CipherSpecs[cipher])
+		}
+	}
+
+	var result *sslv2HandshakeResult
+	var err error
+	if len(specs) > 0 {
+		result, err = probeSSLv2(ctx, dialer, address, specs)
+	}
+
+	var rows []tlsConnectionRow
+	for _, cipher := range ciphers {
+		r := tlsConnectionRow{
+			Version:         "SSL v2",
+			CipherSuiteName: cipher,
+			CipherSuiteID:   fmt.Sprintf("0x%04x", constants.CipherSuites[cipher]),
+			ServerName:      serverName,
+		}
+		spec, ok := constants.SSLv2CipherSpecs[cipher]
+		switch {
+		case !ok:
+			r.Error = "unsupported protocol-cipher combination"
+		case err != nil:
+			r.RawProbe = true
+			r.CipherSuiteID = fmt.Sprintf("0x%06x", spec)
+			r.Error = err.Error()
+		default:
+			r.RawProbe = true
+			r.CipherSuiteID = fmt.Sprintf("0x%06x", spec)
+			r.LocalAddress = result.LocalAddress
+			r.RemoteAddress = result.RemoteAddress
+			r.Accepted = slices.Contains(result.CipherSpecs, spec)
+			if !r.Accepted {
+				r.Error = "server did not accept the cipher spec"
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
 // Initiate a TLS handshake and return TLS connection
-func getTLSConnection(ctx context.Context, address string, protocol string, cipher string) (*tls.Conn, error) {
+func getTLSConnection(ctx context.Context, dialer *proxyDialer, address string, serverName string, protocol string, cipher string, client *clientCertificateRequest) (*tls.Conn, error) {
 	cfg := tls.Config{
 		Rand:               rand.Reader,
 		InsecureSkipVerify: true,
+		ServerName:         serverName,
+	}
+	if client != nil {
+		cfg.GetClientCertificate = client.getClientCertificate
 	}
 
 	// Set protocol versions
@@ -154,7 +377,7 @@ func getTLSConnection(ctx context.Context, address string, protocol string, ciph
 	}
 
 	// Dial the TLS connection
-	conn, err := tls.DialWithDialer(&net.Dialer{}, "tcp", address, &cfg)
+	conn, err := dialTLS(ctx, dialer, address, &cfg)
 	if err != nil {
 		plugin.Logger(ctx).Error("net_tls_connection.getTLSConnection", "TLS connection failed: ", err)
 		return nil, err
@@ -163,6 +386,85 @@ func getTLSConnection(ctx context.Context, address string, protocol string, ciph
 	return conn, nil
 }
 
+// Dial the address and perform a TLS handshake using the given config. Unlike
+// tls.DialWithDialer, the server name is never derived from the address, so
+// that an empty server name sends no server name indication. Callers derive
+// the default server name with getServerNames or defaultServerName.
+func dialTLS(ctx context.Context, dialer *proxyDialer, address string, cfg *tls.Config) (*tls.Conn, error) {
+	rawConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Results of the checks which need their own handshake are cached for the
+// same time as query results, so that every row of a scan shares them
+const tlsServerCheckTTL = 5 * time.Minute
+
+// Concurrent callers of the same check share its handshake
+var tlsServerChecks singleflight.Group
+
+// The cached result of a check, which may be nil
+type tlsServerCheckResult struct {
+	Value interface{}
+}
+
+// Run a check which needs its own handshake once for each address, server
+// name and connection settings, within the same handshake limits as the scan
+func checkTLSServer(ctx context.Context, d *plugin.QueryData, name string, serverName string, cfg *tls.Config, check func(ctx context.Context, conn *tls.Conn, err error) (interface{}, error)) (interface{}, error) {
+	addr := d.EqualsQualString("address")
+	cacheKey := fmt.Sprintf("%s-%s-%s-%s-%s", name, addr, serverName, d.EqualsQualString("proxy"), d.EqualsQualString("client_certificate"))
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(tlsServerCheckResult).Value, nil
+	}
+
+	result, err, _ := tlsServerChecks.Do(cacheKey, func() (interface{}, error) {
+		clientCert, err := getClientCertificate(ctx, d, d.EqualsQualString("client_certificate"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = newClientCertificateRequest(clientCert).getClientCertificate
+		cfg.ServerName = serverName
+
+		dialer, err := getProxyDialer(ctx, d, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		limiter, err := getHandshakeLimiter(ctx, d, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		defer limiter.done(ctx)
+
+		conn, err := dialTLS(ctx, dialer, addr, cfg)
+		if conn != nil {
+			defer conn.Close()
+		}
+		value, err := check(ctx, conn, err)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.ConnectionCache.SetWithTTL(ctx, cacheKey, tlsServerCheckResult{Value: value}, tlsServerCheckTTL); err != nil {
+			plugin.Logger(ctx).Warn("net_tls_connection.checkTLSServer", "cache_set_error", err)
+		}
+		return value, nil
+	})
+	return result, err
+}
+
 // Check if TLS Fallback Signaling Cipher Suite Value supported
 func checkFallbackSCSVSupport(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
 	data := h.Item.(tlsConnectionRow)
@@ -178,19 +480,13 @@ func checkFallbackSCSVSupport(ctx context.Context, d *plugin.QueryData, h *plugi
 		CipherSuites:       []uint16{constants.CipherSuites["TLS_FALLBACK_SCSV"]},
 	}
 
-	addr := d.EqualsQualString("address")
-
-	conn, err := tls.DialWithDialer(&net.Dialer{}, "tcp", addr, &cfg)
-	if err != nil {
-		plugin.Logger(ctx).Error("net_tls_connection.checkFallbackSCSVSupport", "check_fallback_scsv_support", err)
-		return false, nil
-	}
-
-	if conn == nil {
-		return false, nil
-	}
-
-	return true, nil
+	return checkTLSServer(ctx, d, "checkFallbackSCSVSupport", data.ServerName, &cfg, func(ctx context.Context, conn *tls.Conn, err error) (interface{}, error) {
+		if err != nil {
+			plugin.Logger(ctx).Error("net_tls_connection.checkFallbackSCSVSupport", "check_fallback_scsv_support", err)
+			return false, nil
+		}
+		return conn != nil, nil
+	})
 }
 
 // Check if Application-Layer Protocol Negotiation (ALPN) supported
@@ -208,17 +504,14 @@ func checkAPLNSupport(ctx context.Context, d *plugin.QueryData, h *plugin.Hydrat
 		NextProtos:         []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "stun.turn", "stun.nat-discovery", "h2", "h2c", "webrtc", "c-webrtc", "ftp", "imap", "pop3", "managesieve", "coap", "xmpp-client", "xmpp-server", "acme-tls/1", "mqtt", "dot", "ntske/1", "sunrpc", "h3", "smb", "irc", "nntp", "nnsp", "doq"}, // A list of all available TLS ALPN protocol. Please refer: https://www.iana.org/assignments/tls-extensiontype-values/tls-extensiontype-values.xhtml#alpn-protocol-ids
 	}
 
-	addr := d.EqualsQualString("address")
-
-	conn, err := tls.DialWithDialer(&net.Dialer{}, "tcp", addr, &cfg)
-	if err != nil {
-		plugin.Logger(ctx).Error("net_tls_connection.checkAPLNSupport", "check_tls_alpn_support", err)
-		return nil, err
-	}
-
-	if conn.ConnectionState().HandshakeComplete && conn.ConnectionState().NegotiatedProtocol != "" {
-		return true, nil
-	}
-
-	return nil, nil
+	return checkTLSServer(ctx, d, "checkAPLNSupport", data.ServerName, &cfg, func(ctx context.Context, conn *tls.Conn, err error) (interface{}, error) {
+		if err != nil {
+			plugin.Logger(ctx).Error("net_tls_connection.checkAPLNSupport", "check_tls_alpn_support", err)
+			return nil, err
+		}
+		if conn.ConnectionState().HandshakeComplete && conn.ConnectionState().NegotiatedProtocol != "" {
+			return true, nil
+		}
+		return nil, nil
+	})
 }
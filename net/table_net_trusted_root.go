@@ -0,0 +1,67 @@
+package net
+
+import (
+	"context"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableNetTrustedRoot(ctx context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:        "net_trusted_root",
+		Description: "Root certificates and their membership of root programs, e.g. Mozilla, Apple, Microsoft and Chrome, from a snapshot of the CCADB configured in trusted_root_snapshot, or the system trust store.",
+		List: &plugin.ListConfig{
+			Hydrate: tableNetTrustedRootList,
+		},
+		Columns: append([]*plugin.Column{
+			// Top columns
+			{Name: "owner", Type: proto.ColumnType_STRING, Description: "Organization operating the root, from the CA Owner column of the snapshot."},
+			{Name: "root_programs", Type: proto.ColumnType_JSON, Transform: transform.FromField("RootPrograms"), Description: "List of root programs which include the root, e.g. [\"Apple\", \"Mozilla\"]. Membership of these programs requires the trusted_root_snapshot config argument, as the embedded snapshot is empty, otherwise roots are loaded from the system trust store and listed in the System program."},
+			{Name: "program_status", Type: proto.ColumnType_JSON, Transform: transform.FromField("ProgramStatus"), Description: "Status of the root in each root program of the snapshot, e.g. {\"Mozilla\": \"Included\", \"Microsoft\": \"Removed\"}."},
+			{Name: "source", Type: proto.ColumnType_STRING, Description: "Path or URL of the configured snapshot or system trust store the root was loaded from, or embedded for the snapshot embedded in the plugin."},
+		}, certificateColumns()...),
+	}
+}
+
+type tableNetTrustedRootRow struct {
+	tableNetCertificateRow
+	Owner         string
+	RootPrograms  []string
+	ProgramStatus map[string]string
+	Source        string
+}
+
+//// LIST FUNCTION
+
+func tableNetTrustedRootList(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	plugin.Logger(ctx).Trace("tableNetTrustedRootList")
+
+	roots, err := getTrustedRoots(ctx, d)
+	if err != nil {
+		plugin.Logger(ctx).Error("net_trusted_root.tableNetTrustedRootList", "failed to load trusted roots", err)
+		return nil, err
+	}
+
+	for _, pinRoots := range roots {
+		for _, root := range pinRoots {
+			d.StreamListItem(ctx, tableNetTrustedRootRow{
+				tableNetCertificateRow: getCertificateRow(root.cert),
+				Owner:                  root.Owner,
+				RootPrograms:           root.rootPrograms(),
+				ProgramStatus:          root.ProgramStatus,
+				Source:                 root.Source,
+			})
+
+			// Context can be cancelled due to manual cancellation or the limit has been hit
+			if d.RowsRemaining(ctx) == 0 {
+				return nil, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
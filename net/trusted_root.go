@@ -0,0 +1,346 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+//go:generate go run generate_trusted_roots.go
+
+// Snapshot of the root certificates in the CCADB, with their status in each
+// root program, generated by generate_trusted_roots.go
+//
+//go:embed trusted_roots.csv
+var embeddedTrustedRoots []byte
+
+// Source reported for the roots of the embedded snapshot
+const embeddedTrustedRootSource = "embedded"
+
+// Root program used for roots loaded from the system trust store, when the
+// embedded snapshot is empty and no trusted root snapshot is configured. The
+// system trust store is usually derived from a root program, e.g. Mozilla on
+// most Linux distributions, but is not one itself.
+const systemRootProgram = "System"
+
+// Status of a root which is trusted by a root program
+const rootProgramIncluded = "Included"
+
+// Root programs with a status column in the CCADB root reports
+var ccadbRootPrograms = []string{"Apple", "Chrome", "Microsoft", "Mozilla"}
+
+// Locations of the system trust store on common operating systems, in the
+// order they are tried. SSL_CERT_FILE takes precedence, as in the x509
+// package.
+var systemRootBundlePaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// A root certificate, along with its status in each root program
+type trustedRoot struct {
+	Owner         string
+	ProgramStatus map[string]string
+	Source        string
+
+	cert *x509.Certificate
+}
+
+// The root programs which include the root
+func (r trustedRoot) rootPrograms() []string {
+	programs := []string{}
+	for program, status := range r.ProgramStatus {
+		if strings.EqualFold(status, rootProgramIncluded) {
+			programs = append(programs, program)
+		}
+	}
+	sort.Strings(programs)
+	return programs
+}
+
+// Trusted roots, keyed by the SPKI pin of the root
+type trustedRootSet map[string][]trustedRoot
+
+// Returns the roots from the configured trusted root snapshot, which refreshes
+// or overrides the embedded snapshot, or from the embedded snapshot otherwise.
+// The system trust store is used if the embedded snapshot is empty. The roots
+// are cached for an hour, so a snapshot which is replaced or updated at its URL
+// is picked up without restarting the plugin.
+func getTrustedRoots(ctx context.Context, d *plugin.QueryData) (trustedRootSet, error) {
+	cacheKey := "getTrustedRoots"
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(trustedRootSet), nil
+	}
+
+	var roots []trustedRoot
+	var err error
+	config := GetConfig(d.Connection)
+	if config.TrustedRootSnapshot != nil {
+		roots, err = loadTrustedRootSnapshot(ctx, d, *config.TrustedRootSnapshot)
+	} else {
+		roots, err = parseTrustedRootSnapshot(ctx, embeddedTrustedRoots, embeddedTrustedRootSource)
+		if err == nil && len(roots) == 0 {
+			// Root program membership is unknown without a snapshot
+			plugin.Logger(ctx).Warn("getTrustedRoots", "embedded trusted root snapshot is empty, using the system trust store")
+			roots, err = loadSystemTrustedRoots()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := trustedRootSet{}
+	for _, root := range roots {
+		pin := getSPKIPin(root.cert)
+		set[pin] = append(set[pin], root)
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, set); err != nil {
+		plugin.Logger(ctx).Warn("getTrustedRoots", "failed to cache trusted roots", err)
+	}
+
+	return set, nil
+}
+
+// Load the roots from a CCADB style snapshot in CSV format, read from a local
+// path or downloaded from an http or https URL
+func loadTrustedRootSnapshot(ctx context.Context, d *plugin.QueryData, source string) ([]trustedRoot, error) {
+	var content []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		content, err = downloadTrustedRootSnapshot(ctx, d, source)
+	} else {
+		content, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted root snapshot %s: %v", source, err)
+	}
+	return parseTrustedRootSnapshot(ctx, content, source)
+}
+
+// Parse the roots from a CCADB style snapshot in CSV format. The first row
+// names the columns, which are matched case-insensitively:
+//
+//   - "PEM" or "X.509 Certificate (PEM)" (required): the root certificate.
+//   - "Apple Status", "Chrome Status", "Microsoft Status" and "Mozilla Status":
+//     the status of the root in each root program, as in the CCADB reports.
+//   - "Status of Root Cert" or "Root Programs": the status of the root in
+//     every root program in a single column, e.g. "Apple: Included; Mozilla:
+//     Removed". Either this or the per program columns are required.
+//   - "CA Owner" or "Owner": the organization operating the root.
+//
+// A snapshot with only a header row has no roots.
+func parseTrustedRootSnapshot(ctx context.Context, content []byte, source string) ([]trustedRoot, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted root snapshot %s: %v", source, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("trusted root snapshot %s is empty", source)
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	findColumn := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := columns[strings.ToLower(name)]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	pemColumn := findColumn("PEM", "X.509 Certificate (PEM)")
+	statusColumn := findColumn("Status of Root Cert", "Root Programs")
+	ownerColumn := findColumn("CA Owner", "Owner")
+	programColumns := map[string]int{}
+	for _, program := range ccadbRootPrograms {
+		if i := findColumn(program + " Status"); i >= 0 {
+			programColumns[program] = i
+		}
+	}
+	if pemColumn < 0 || (statusColumn < 0 && len(programColumns) == 0) {
+		return nil, fmt.Errorf("trusted root snapshot %s must have a PEM column, and either a Status of Root Cert column or a status column for each root program", source)
+	}
+
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var roots []trustedRoot
+	for line, record := range records[1:] {
+		certs, err := parsePEMCertificates([]byte(field(record, pemColumn)))
+		if err != nil {
+			// Skip entries without a usable certificate, rather than failing
+			// the whole snapshot
+			plugin.Logger(ctx).Warn("loadTrustedRootSnapshot", "invalid certificate", source, "line", line+2, "error", err)
+			continue
+		}
+		status := parseRootProgramStatus(field(record, statusColumn))
+		for program, i := range programColumns {
+			if value := field(record, i); value != "" {
+				status[program] = value
+			}
+		}
+		roots = append(roots, trustedRoot{
+			Owner:         field(record, ownerColumn),
+			ProgramStatus: status,
+			Source:        source,
+			cert:          certs[0],
+		})
+	}
+
+	return roots, nil
+}
+
+// Download the trusted root snapshot, using the proxy configured for the
+// connection
+func downloadTrustedRootSnapshot(ctx context.Context, d *plugin.QueryData, url string) ([]byte, error) {
+	client, err := getProxyHTTPClient(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Parse the status of a root in each root program, in the format used by the
+// CCADB reports, e.g. "Apple: Included; Google Chrome: Included; Microsoft:
+// Removed"
+func parseRootProgramStatus(value string) map[string]string {
+	status := map[string]string{}
+	for _, entry := range strings.Split(value, ";") {
+		parts := strings.SplitN(entry, ":", 2)
+		program := strings.TrimSpace(parts[0])
+		if program == "" {
+			continue
+		}
+		// A program listed without a status includes the root
+		programStatus := rootProgramIncluded
+		if len(parts) == 2 && strings.TrimSpace(parts[1]) != "" {
+			programStatus = strings.TrimSpace(parts[1])
+		}
+		status[program] = programStatus
+	}
+	return status
+}
+
+// Load the roots from the first system trust store found
+func loadSystemTrustedRoots() ([]trustedRoot, error) {
+	paths := systemRootBundlePaths
+	if path := os.Getenv("SSL_CERT_FILE"); path != "" {
+		paths = append([]string{path}, paths...)
+	}
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		certs, err := parsePEMCertificates(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse system trust store %s: %v", path, err)
+		}
+		var roots []trustedRoot
+		for _, cert := range certs {
+			roots = append(roots, trustedRoot{
+				ProgramStatus: map[string]string{systemRootProgram: rootProgramIncluded},
+				Source:        path,
+				cert:          cert,
+			})
+		}
+		return roots, nil
+	}
+
+	return nil, fmt.Errorf("no system trust store found, configure trusted_root_snapshot instead")
+}
+
+// Find the trust anchor of the presented chain in the trusted roots. The anchor
+// is a presented certificate whose public key is a trusted root, usually the
+// last one if the server sends its root, or otherwise a trusted root which
+// issued the last certificate on the path from the leaf.
+func (s trustedRootSet) findAnchor(chain []*x509.Certificate) *trustedRoot {
+	for _, c := range chain {
+		if roots, ok := s[getSPKIPin(c)]; ok {
+			return mergeTrustedRoots(roots)
+		}
+	}
+
+	// Follow the issuers from the leaf through the presented certificates, in
+	// any order
+	last := chain[0]
+	used := map[int]bool{0: true}
+	for {
+		next := -1
+		for i, c := range chain {
+			if !used[i] && isCertificateIssuedBy(last, c) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		last = chain[next]
+		used[next] = true
+	}
+
+	for _, roots := range s {
+		for i := range roots {
+			if isCertificateIssuedBy(last, roots[i].cert) {
+				return mergeTrustedRoots(roots)
+			}
+		}
+	}
+	return nil
+}
+
+// Merge the snapshot rows of roots which share a public key, e.g. a root which
+// was re-issued with a new validity period, and is included by some root
+// programs in each version. A program includes the merged root if it includes
+// any of them.
+func mergeTrustedRoots(roots []trustedRoot) *trustedRoot {
+	merged := roots[0]
+	merged.ProgramStatus = map[string]string{}
+	for _, root := range roots {
+		if merged.Owner == "" {
+			merged.Owner = root.Owner
+		}
+		for program, status := range root.ProgramStatus {
+			if current, ok := merged.ProgramStatus[program]; !ok || !strings.EqualFold(current, rootProgramIncluded) {
+				merged.ProgramStatus[program] = status
+			}
+		}
+	}
+	return &merged
+}
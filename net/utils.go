@@ -3,7 +3,13 @@ package net
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 	"unicode/utf8"
 
@@ -165,8 +171,7 @@ func cipherSuitesUptoTLS11() []string {
 // Check if given cipher suite is supported by the given protocol version
 func cipherSuiteIsSupported(protocol string, cipher string) bool {
 	switch protocol {
-	case "TLS v1.0":
-	case "TLS v1.1":
+	case "TLS v1.0", "TLS v1.1":
 		ciphers := cipherSuitesUptoTLS11()
 		return slices.Contains(ciphers, cipher)
 	case "TLS v1.2":
@@ -209,3 +214,77 @@ func retryHydrate(ctx context.Context, d *plugin.QueryData, hydrateData *plugin.
 
 	return hydrateResult, err
 }
+
+// Returns the host of the given address to be used as server name indication,
+// or an empty string if the host is an IP address
+func defaultServerName(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+// Returns the server names to send as server name indication, from the
+// server_name qual, or the host of the address by default. An empty server
+// name sends no server name indication.
+func getServerNames(d *plugin.QueryData, address string) []string {
+	if d.EqualsQuals["server_name"] != nil {
+		return getQuals(d.EqualsQuals["server_name"])
+	}
+	return []string{defaultServerName(address)}
+}
+
+// Returns the pool of trusted root certificates, i.e. the system roots along
+// with the certificates from the configured CA bundles
+func getRootCertificatePool(ctx context.Context, d *plugin.QueryData) (*x509.CertPool, error) {
+	cacheKey := "getRootCertificatePool"
+	if cachedData, ok := d.ConnectionCache.Get(ctx, cacheKey); ok {
+		return cachedData.(*x509.CertPool), nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		plugin.Logger(ctx).Warn("getRootCertificatePool", "failed to load system roots", err)
+		pool = x509.NewCertPool()
+	}
+
+	config := GetConfig(d.Connection)
+	for _, pattern := range config.CABundlePaths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ca_bundle_paths pattern %s: %v", pattern, err)
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle %s: %v", path, err)
+			}
+			if !pool.AppendCertsFromPEM(content) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+			}
+		}
+	}
+
+	if err := d.ConnectionCache.Set(ctx, cacheKey, pool); err != nil {
+		plugin.Logger(ctx).Warn("getRootCertificatePool", "failed to cache root pool", err)
+	}
+
+	return pool, nil
+}
+
+// Read the whole response body, failing if it is larger than the given limit
+// rather than reading an unbounded amount into memory
+func readResponseBody(resp *http.Response, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response is larger than %d bytes", limit)
+	}
+	return body, nil
+}